@@ -4,17 +4,72 @@ import (
 	"log/slog"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
 
+const (
+	IngestionModeRow  = "row"
+	IngestionModeCopy = "copy"
+)
+
+const (
+	RemovalModeSoft     = "soft"
+	RemovalModeHard     = "hard"
+	RemovalModeDisabled = "off"
+)
+
+const (
+	FailurePolicyFailFast = "fail_fast"
+	FailurePolicyCollect  = "collect"
+)
+
+const (
+	JobModeCards  = "cards"
+	JobModePrices = "prices"
+)
+
+const defaultUserAgent = "spellscan-card-loader/1.0"
+
 type Config struct {
+	JobMode                 string
 	DbDsn                   string
 	DbMaxConnections        int
+	DbMaxRetries            int
+	DbIngestionMode         string
+	DbCopyBatchSize         int
+	DbWorkers               int
+	DbFailurePolicy         string
+	CardRemovalMode         string
+	CardRemovalMaxPercent   float64
 	MeiliApiKey             string
 	MeiliUrl                string
+	MeiliKeepIndexes        int
+	MeiliTaskTimeout        time.Duration
+	MeiliPollInterval       time.Duration
+	MeiliMaxPendingTasks    int
+	MeiliFullRebuild        bool
+	ScryfallBaseUrl         string
+	ScryfallTimeout         time.Duration
+	ScryfallProxy           string
+	ScryfallUserAgent       string
+	ScryfallRequestInterval time.Duration
+	BulkTypes               []string
+	LoadRulings             bool
+	LoadTokens              bool
+	ExcludedSetTypes        []string
+	FiltersFile             string
 	SkipDownload            bool
-	UseReleaseDateReference bool
+	BulkStream              bool
+	BulkStreamCache         bool
+	BulkCacheDir            string
+	DownloadMaxRetries      int
+	DownloadRetryBackoff    time.Duration
+	NewReleasesOnly         bool
+	FullReload              bool
+	ShutdownTimeout         time.Duration
 }
 
 func LoadConfig() *Config {
@@ -22,14 +77,48 @@ func LoadConfig() *Config {
 		slog.Warn("Could not load .env file, using env variables instead")
 	}
 
-	return &Config{
+	cfg := &Config{
+		JobMode:                 jobMode(),
 		DbDsn:                   os.Getenv("DB_DSN"),
 		DbMaxConnections:        parseIntVar("DB_MAX_CONNECTIONS"),
+		DbMaxRetries:            intOrDefault("DB_MAX_RETRIES", 3),
+		DbIngestionMode:         ingestionMode(),
+		DbCopyBatchSize:         intOrDefault("DB_COPY_BATCH_SIZE", 1000),
+		DbFailurePolicy:         failurePolicy(),
+		CardRemovalMode:         removalMode(),
+		CardRemovalMaxPercent:   floatOrDefault("CARD_REMOVAL_MAX_PERCENT", 5),
 		MeiliApiKey:             os.Getenv("MEILI_API_KEY"),
 		MeiliUrl:                os.Getenv("MEILI_URL"),
+		MeiliKeepIndexes:        intOrDefault("MEILI_KEEP_INDEXES", 1),
+		MeiliTaskTimeout:        durationOrDefault("MEILI_TASK_TIMEOUT", 10*time.Minute),
+		MeiliPollInterval:       durationOrDefault("MEILI_POLL_INTERVAL", 500*time.Millisecond),
+		MeiliMaxPendingTasks:    intOrDefault("MEILI_MAX_PENDING_TASKS", 20),
+		MeiliFullRebuild:        boolOrFalse("MEILI_FULL_REBUILD"),
+		ScryfallBaseUrl:         strings.TrimSuffix(stringOrDefault("SCRYFALL_BASE_URL", "https://api.scryfall.com"), "/"),
+		ScryfallTimeout:         durationOrDefault("SCRYFALL_TIMEOUT", 30*time.Second),
+		ScryfallProxy:           os.Getenv("SCRYFALL_PROXY"),
+		ScryfallUserAgent:       stringOrDefault("SCRYFALL_USER_AGENT", defaultUserAgent),
+		ScryfallRequestInterval: durationOrDefault("SCRYFALL_REQUEST_INTERVAL", 100*time.Millisecond),
+		BulkTypes:               listOrDefault("BULK_TYPES", []string{"all_cards"}),
+		LoadRulings:             boolOrFalse("LOAD_RULINGS"),
+		LoadTokens:              boolOrFalse("LOAD_TOKENS"),
+		ExcludedSetTypes:        listOrDefault("EXCLUDED_SET_TYPES", nil),
+		FiltersFile:             os.Getenv("FILTERS_FILE"),
 		SkipDownload:            boolOrFalse("SKIP_DOWNLOAD"),
-		UseReleaseDateReference: boolOrFalse("USE_RELEASE_DATE_REFERENCE"),
+		BulkStream:              boolOrFalse("BULK_STREAM"),
+		BulkStreamCache:         boolOrFalse("BULK_STREAM_CACHE"),
+		BulkCacheDir:            stringOrDefault("BULK_CACHE_DIR", "tmp"),
+		DownloadMaxRetries:      intOrDefault("DOWNLOAD_MAX_RETRIES", 5),
+		DownloadRetryBackoff:    durationOrDefault("DOWNLOAD_RETRY_BACKOFF", time.Second),
+		NewReleasesOnly:         newReleasesOnly(),
+		FullReload:              boolOrFalse("FULL_RELOAD"),
+		ShutdownTimeout:         durationOrDefault("SHUTDOWN_TIMEOUT", 30*time.Second),
 	}
+
+	// More workers than connections would only wait for a connection.
+	cfg.DbWorkers = intOrDefault("DB_WORKERS", cfg.DbMaxConnections)
+
+	return cfg
 }
 
 func boolOrFalse(variable string) bool {
@@ -53,3 +142,136 @@ func parseIntVar(variable string) int {
 
 	return value
 }
+
+func intOrDefault(variable string, def int) int {
+	raw := os.Getenv(variable)
+
+	if raw == "" {
+		return def
+	}
+
+	value, err := strconv.Atoi(raw)
+
+	if err != nil {
+		slog.Warn("Could not convert variable to int, using default", "variable", variable, "default", def)
+		return def
+	}
+
+	return value
+}
+
+func durationOrDefault(variable string, def time.Duration) time.Duration {
+	raw := os.Getenv(variable)
+
+	if raw == "" {
+		return def
+	}
+
+	value, err := time.ParseDuration(raw)
+
+	if err != nil {
+		slog.Warn("Could not convert variable to duration, using default", "variable", variable, "default", def)
+		return def
+	}
+
+	return value
+}
+
+func ingestionMode() string {
+	switch mode := os.Getenv("DB_INGESTION_MODE"); mode {
+	case "", IngestionModeRow:
+		return IngestionModeRow
+	case IngestionModeCopy:
+		return IngestionModeCopy
+	default:
+		slog.Warn("Unknown ingestion mode, using row", "mode", mode)
+		return IngestionModeRow
+	}
+}
+
+// newReleasesOnly reads NEW_RELEASES_ONLY, falling back to its previous name.
+func newReleasesOnly() bool {
+	if os.Getenv("USE_RELEASE_DATE_REFERENCE") != "" {
+		slog.Warn("USE_RELEASE_DATE_REFERENCE is deprecated, use NEW_RELEASES_ONLY")
+		return boolOrFalse("USE_RELEASE_DATE_REFERENCE")
+	}
+
+	return boolOrFalse("NEW_RELEASES_ONLY")
+}
+
+func failurePolicy() string {
+	switch policy := os.Getenv("DB_FAILURE_POLICY"); policy {
+	case "", FailurePolicyFailFast:
+		return FailurePolicyFailFast
+	case FailurePolicyCollect:
+		return FailurePolicyCollect
+	default:
+		slog.Warn("Unknown failure policy, using fail_fast", "policy", policy)
+		return FailurePolicyFailFast
+	}
+}
+
+func jobMode() string {
+	switch mode := os.Getenv("JOB_MODE"); mode {
+	case "", JobModeCards:
+		return JobModeCards
+	case JobModePrices:
+		return JobModePrices
+	default:
+		slog.Warn("Unknown job mode, using cards", "mode", mode)
+		return JobModeCards
+	}
+}
+
+func removalMode() string {
+	switch mode := os.Getenv("CARD_REMOVAL_MODE"); mode {
+	case "", RemovalModeSoft:
+		return RemovalModeSoft
+	case RemovalModeHard, RemovalModeDisabled:
+		return mode
+	default:
+		slog.Warn("Unknown card removal mode, using soft", "mode", mode)
+		return RemovalModeSoft
+	}
+}
+
+func floatOrDefault(variable string, def float64) float64 {
+	raw := os.Getenv(variable)
+
+	if raw == "" {
+		return def
+	}
+
+	value, err := strconv.ParseFloat(raw, 64)
+
+	if err != nil {
+		slog.Warn("Could not convert variable to float, using default", "variable", variable, "default", def)
+		return def
+	}
+
+	return value
+}
+
+func stringOrDefault(variable string, def string) string {
+	if value := os.Getenv(variable); value != "" {
+		return value
+	}
+
+	return def
+}
+
+func listOrDefault(variable string, def []string) []string {
+	var values []string
+
+	for _, value := range strings.Split(os.Getenv(variable), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+
+	if len(values) == 0 {
+		return def
+	}
+
+	return values
+}
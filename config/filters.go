@@ -0,0 +1,70 @@
+package config
+
+import (
+	"encoding/json"
+	"os"
+)
+
+// FilterList selects cards by a value of theirs. A card passes when Include is
+// empty or contains the value, and Exclude does not contain it.
+type FilterList struct {
+	Include []string `json:"include"`
+	Exclude []string `json:"exclude"`
+}
+
+// FilterConfig decides which cards of a bulk file are loaded. Dates are
+// inclusive and written as YYYY-MM-DD.
+type FilterConfig struct {
+	Langs         FilterList `json:"langs"`
+	Layouts       FilterList `json:"layouts"`
+	SetTypes      FilterList `json:"set_types"`
+	Sets          FilterList `json:"sets"`
+	Games         FilterList `json:"games"`
+	PromoTypes    FilterList `json:"promo_types"`
+	Digital       bool       `json:"digital"`
+	Oversized     bool       `json:"oversized"`
+	Unreleased    bool       `json:"unreleased"`
+	ReleasedFrom  string     `json:"released_from"`
+	ReleasedUntil string     `json:"released_until"`
+}
+
+// DefaultFilters loads released, non-digital printings in the supported
+// languages, leaving out layouts that are not playable cards.
+func DefaultFilters() FilterConfig {
+	return FilterConfig{
+		Langs: FilterList{Include: []string{"en", "pt", "es", "fr", "de", "it"}},
+		Layouts: FilterList{Exclude: []string{"token", "emblem", "augment", "host", "vanguard",
+			"reversible_card", "scheme", "art_series", "double_faced_token"}},
+		Oversized: true,
+	}
+}
+
+// LoadFilters reads the filter rules from cfg.FiltersFile, or uses
+// DefaultFilters when it is not set. EXCLUDED_SET_TYPES is added to the excluded
+// set types either way.
+func LoadFilters(cfg *Config) (FilterConfig, error) {
+	filters := DefaultFilters()
+
+	if cfg.FiltersFile != "" {
+		f, err := os.Open(cfg.FiltersFile)
+
+		if err != nil {
+			return filters, err
+		}
+
+		defer f.Close()
+
+		filters = FilterConfig{}
+
+		dec := json.NewDecoder(f)
+		dec.DisallowUnknownFields()
+
+		if err := dec.Decode(&filters); err != nil {
+			return filters, err
+		}
+	}
+
+	filters.SetTypes.Exclude = append(filters.SetTypes.Exclude, cfg.ExcludedSetTypes...)
+
+	return filters, nil
+}
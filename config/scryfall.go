@@ -0,0 +1,83 @@
+package config
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// ScryfallClient builds the HTTP client used for every Scryfall request. It sets
+// the User-Agent and Accept headers Scryfall requires and spaces requests out by
+// SCRYFALL_REQUEST_INTERVAL. SCRYFALL_TIMEOUT bounds connecting and waiting for
+// response headers, not reading bodies, since bulk files take minutes to download.
+func ScryfallClient(cfg *Config) (*http.Client, error) {
+	proxy := http.ProxyFromEnvironment
+
+	if cfg.ScryfallProxy != "" {
+		proxyUrl, err := url.Parse(cfg.ScryfallProxy)
+
+		if err != nil {
+			return nil, err
+		}
+
+		proxy = http.ProxyURL(proxyUrl)
+	}
+
+	transport := &http.Transport{
+		Proxy:                 proxy,
+		DialContext:           (&net.Dialer{Timeout: cfg.ScryfallTimeout}).DialContext,
+		TLSHandshakeTimeout:   cfg.ScryfallTimeout,
+		ResponseHeaderTimeout: cfg.ScryfallTimeout,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          10,
+		IdleConnTimeout:       90 * time.Second,
+	}
+
+	return &http.Client{
+		Transport: &scryfallTransport{
+			base:      transport,
+			userAgent: cfg.ScryfallUserAgent,
+			interval:  cfg.ScryfallRequestInterval,
+		},
+	}, nil
+}
+
+type scryfallTransport struct {
+	base      http.RoundTripper
+	userAgent string
+	interval  time.Duration
+	mu        sync.Mutex
+	next      time.Time
+}
+
+func (t *scryfallTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.wait()
+
+	req = req.Clone(req.Context())
+	req.Header.Set("User-Agent", t.userAgent)
+
+	if req.Header.Get("Accept") == "" {
+		req.Header.Set("Accept", "application/json;q=0.9,*/*;q=0.8")
+	}
+
+	return t.base.RoundTrip(req)
+}
+
+func (t *scryfallTransport) wait() {
+	t.mu.Lock()
+
+	now := time.Now()
+	delay := t.next.Sub(now)
+
+	if delay < 0 {
+		delay = 0
+	}
+
+	t.next = now.Add(delay + t.interval)
+
+	t.mu.Unlock()
+
+	time.Sleep(delay)
+}
@@ -0,0 +1,18 @@
+package filters
+
+// The values Scryfall documents for the card fields the filters can select on.
+
+var languages = []string{"en", "es", "fr", "de", "it", "pt", "ja", "ko", "ru", "zhs", "zht",
+	"he", "la", "grc", "ar", "sa", "ph", "qya"}
+
+var layouts = []string{"normal", "split", "flip", "transform", "modal_dfc", "meld", "leveler",
+	"class", "case", "saga", "adventure", "mutate", "prototype", "battle", "planar", "scheme",
+	"vanguard", "token", "double_faced_token", "emblem", "augment", "host", "art_series",
+	"reversible_card"}
+
+var setTypes = []string{"core", "expansion", "masters", "eternal", "alchemy", "masterpiece",
+	"arsenal", "from_the_vault", "spellbook", "premium_deck", "duel_deck", "draft_innovation",
+	"treasure_chest", "commander", "planechase", "archenemy", "vanguard", "funny", "starter",
+	"box", "promo", "token", "memorabilia", "minigame"}
+
+var games = []string{"paper", "arena", "mtgo", "astral", "sega"}
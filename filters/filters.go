@@ -0,0 +1,237 @@
+package filters
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"spellscan.com/card-loader/config"
+	"spellscan.com/card-loader/objects"
+)
+
+var ErrInvalidFilters = errors.New("invalid card filters")
+
+// TokenLayouts are the layouts loaded into the tokens catalog instead of the
+// cards one.
+var TokenLayouts = []string{"token", "double_faced_token", "emblem", "art_series"}
+
+// Rule names the check that rejected a card in the job result.
+type Rule string
+
+const (
+	RuleLang          Rule = "lang"
+	RuleLayout        Rule = "layout"
+	RuleSetType       Rule = "set_type"
+	RuleSet           Rule = "set"
+	RuleGames         Rule = "games"
+	RulePromoTypes    Rule = "promo_types"
+	RuleDigital       Rule = "digital"
+	RuleOversized     Rule = "oversized"
+	RuleUnreleased    Rule = "unreleased"
+	RuleReleasedFrom  Rule = "released_from"
+	RuleReleasedUntil Rule = "released_until"
+)
+
+// Rules are validated filter settings.
+type Rules struct {
+	cfg           config.FilterConfig
+	releasedFrom  *time.Time
+	releasedUntil *time.Time
+}
+
+// NewRules validates cfg against the values Scryfall documents, so that a typo
+// such as "sp" for Spanish fails at startup instead of dropping every card.
+// Set codes and promo types change with every release and are not checked.
+func NewRules(cfg config.FilterConfig) (*Rules, error) {
+	var problems []string
+
+	problems = append(problems, unknownValues("langs", cfg.Langs, languages)...)
+	problems = append(problems, unknownValues("layouts", cfg.Layouts, layouts)...)
+	problems = append(problems, unknownValues("set_types", cfg.SetTypes, setTypes)...)
+	problems = append(problems, unknownValues("games", cfg.Games, games)...)
+
+	rules := &Rules{cfg: cfg}
+
+	var err error
+
+	if rules.releasedFrom, err = parseDate(cfg.ReleasedFrom); err != nil {
+		problems = append(problems, fmt.Sprintf("released_from: %v", err))
+	}
+
+	if rules.releasedUntil, err = parseDate(cfg.ReleasedUntil); err != nil {
+		problems = append(problems, fmt.Sprintf("released_until: %v", err))
+	}
+
+	if len(problems) != 0 {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidFilters, strings.Join(problems, "; "))
+	}
+
+	return rules, nil
+}
+
+// WithReleasedFrom returns a copy of the rules that also rejects cards released
+// before from.
+func (r *Rules) WithReleasedFrom(from time.Time) *Rules {
+	narrowed := *r
+
+	if narrowed.releasedFrom == nil || from.After(*narrowed.releasedFrom) {
+		narrowed.releasedFrom = &from
+	}
+
+	return &narrowed
+}
+
+// WithLayouts returns a copy of the rules that selects layouts with list instead.
+func (r *Rules) WithLayouts(list config.FilterList) *Rules {
+	narrowed := *r
+	narrowed.cfg.Layouts = list
+
+	return &narrowed
+}
+
+type CardFilter interface {
+	// Accept reports whether card passes every rule. Rejected cards are counted
+	// under the first rule they failed.
+	Accept(card *objects.Card) bool
+	// Rejections returns how many cards each rule rejected so far.
+	Rejections() map[string]int
+}
+
+type cardFilter struct {
+	rules      *Rules
+	mu         sync.Mutex
+	rejections map[string]int
+}
+
+func NewCardFilter(rules *Rules) CardFilter {
+	return &cardFilter{rules: rules, rejections: make(map[string]int)}
+}
+
+func (f *cardFilter) Accept(card *objects.Card) bool {
+	rule, ok := f.rules.check(card)
+
+	if !ok {
+		f.mu.Lock()
+		f.rejections[string(rule)]++
+		f.mu.Unlock()
+	}
+
+	return ok
+}
+
+func (f *cardFilter) Rejections() map[string]int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	rejections := make(map[string]int, len(f.rejections))
+
+	for rule, count := range f.rejections {
+		rejections[rule] = count
+	}
+
+	return rejections
+}
+
+func (r *Rules) check(card *objects.Card) (Rule, bool) {
+	cfg := r.cfg
+
+	if card.Digital && !cfg.Digital {
+		return RuleDigital, false
+	}
+
+	if card.Oversized && !cfg.Oversized {
+		return RuleOversized, false
+	}
+
+	if !matches(cfg.Langs, card.Lang) {
+		return RuleLang, false
+	}
+
+	if !matches(cfg.Layouts, card.Layout) {
+		return RuleLayout, false
+	}
+
+	if !matches(cfg.SetTypes, card.SetType) {
+		return RuleSetType, false
+	}
+
+	if !matches(cfg.Sets, card.Set) {
+		return RuleSet, false
+	}
+
+	if !matchesAny(cfg.Games, card.Games) {
+		return RuleGames, false
+	}
+
+	if !matchesAny(cfg.PromoTypes, card.PromoTypes) {
+		return RulePromoTypes, false
+	}
+
+	releasedAt, err := time.Parse(time.DateOnly, card.ReleasedAt)
+
+	// Without a release date there is nothing to compare against.
+	if err != nil {
+		return "", true
+	}
+
+	if !cfg.Unreleased && releasedAt.After(time.Now()) {
+		return RuleUnreleased, false
+	}
+
+	if r.releasedFrom != nil && releasedAt.Before(*r.releasedFrom) {
+		return RuleReleasedFrom, false
+	}
+
+	if r.releasedUntil != nil && releasedAt.After(*r.releasedUntil) {
+		return RuleReleasedUntil, false
+	}
+
+	return "", true
+}
+
+func matches(list config.FilterList, value string) bool {
+	if len(list.Include) != 0 && !slices.Contains(list.Include, value) {
+		return false
+	}
+
+	return !slices.Contains(list.Exclude, value)
+}
+
+// matchesAny applies list to a card with several values: it passes when one of
+// them is included and none is excluded.
+func matchesAny(list config.FilterList, values []string) bool {
+	if len(list.Include) != 0 && !slices.ContainsFunc(values, func(v string) bool { return slices.Contains(list.Include, v) }) {
+		return false
+	}
+
+	return !slices.ContainsFunc(values, func(v string) bool { return slices.Contains(list.Exclude, v) })
+}
+
+func parseDate(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	date, err := time.Parse(time.DateOnly, value)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &date, nil
+}
+
+func unknownValues(name string, list config.FilterList, known []string) []string {
+	var problems []string
+
+	for _, value := range append(slices.Clone(list.Include), list.Exclude...) {
+		if !slices.Contains(known, value) {
+			problems = append(problems, fmt.Sprintf("%s: unknown value %q", name, value))
+		}
+	}
+
+	return problems
+}
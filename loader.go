@@ -0,0 +1,682 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"spellscan.com/card-loader/config"
+	"spellscan.com/card-loader/filters"
+	"spellscan.com/card-loader/models"
+	"spellscan.com/card-loader/objects"
+	"spellscan.com/card-loader/services"
+	"spellscan.com/card-loader/workers"
+)
+
+type loader struct {
+	cfg              *config.Config
+	meiliService     services.MeiliService
+	metadataService  services.MetadataService
+	cardRepository   models.CardRepository
+	rulingRepository models.RulingRepository
+	setRepository    models.SetRepository
+	priceRepository  models.PriceRepository
+	tokenRepository  models.TokenRepository
+	filterRules      *filters.Rules
+	// drainCtx bounds the Meilisearch flush and cleanup of a cancelled job. It
+	// outlives the job context and is cancelled shortly before the shutdown
+	// timeout, leaving time to record the job result.
+	drainCtx context.Context
+}
+
+// loadFunc loads one bulk file. It returns a job result even when it fails, with
+// the work done up to that point.
+type loadFunc func(ctx context.Context, bulkData *objects.BulkMetadata) (*models.JobResult, error)
+
+// run loads bulkData with load and records the outcome in job_results, as
+// cancelled when ctx was cancelled and as failed on any other error.
+func (l *loader) run(ctx context.Context, bulkData *objects.BulkMetadata, load loadFunc) error {
+	result, err := load(ctx, bulkData)
+
+	if result == nil {
+		result = &models.JobResult{Started: time.Now()}
+	}
+
+	if result.Finished.IsZero() {
+		result.Finished = time.Now()
+	}
+
+	if result.JobMode == "" {
+		result.JobMode = l.cfg.JobMode
+	}
+
+	switch {
+	case err == nil:
+		result.Status = models.JobStatusSucceeded
+	case errors.Is(err, context.Canceled) || ctx.Err() != nil:
+		result.Status = models.JobStatusCancelled
+	default:
+		result.Status = models.JobStatusFailed
+	}
+
+	if saveErr := l.metadataService.Save(bulkData, result); saveErr != nil {
+		slog.Error("Could not save job result in database", "bulkType", bulkData.Type, "status", result.Status, "err", saveErr)
+	}
+
+	// A staging index that was not swapped in is never left behind. Deleting it
+	// waits behind the tasks still queued on it, so it comes after the result.
+	if err := l.meiliService.DiscardStagingIndex(l.drainCtx); err != nil {
+		slog.Warn("Could not discard staging index", "err", err)
+	}
+
+	return err
+}
+
+// loadSets upserts every Scryfall set. Cards reference sets by code, so this runs
+// before any card is written.
+func (l *loader) loadSets(ctx context.Context) error {
+	remoteSets, err := l.metadataService.GetRemoteSets(ctx)
+
+	if err != nil {
+		return fmt.Errorf("could not get sets from remote server: %w", err)
+	}
+
+	var sets []*models.Set
+
+	for i := range remoteSets {
+		sets = append(sets, models.FromSetJson(&remoteSets[i]))
+	}
+
+	if err := l.setRepository.SaveAll(ctx, sets); err != nil {
+		return fmt.Errorf("could not save sets in database: %w", err)
+	}
+
+	slog.Info("Loaded sets", "count", len(sets))
+
+	return nil
+}
+
+// loadCatalog writes the cards of the catalog bulk file to Postgres and
+// Meilisearch and removes the ones that disappeared from it.
+//
+// When ctx is cancelled or a write fails no new card is read. A cancelled write is
+// rolled back, and the cards already written are flushed to Meilisearch, so that
+// the next run does not skip them as unchanged.
+func (l *loader) loadCatalog(ctx context.Context, bulkData *objects.BulkMetadata) (*models.JobResult, error) {
+	bulkFile, err := l.metadataService.OpenBulkFile(ctx, bulkData)
+
+	if err != nil {
+		return nil, fmt.Errorf("could not download bulk data from remote server: %w", err)
+	}
+
+	// sendToChannel closes the bulk file once it starts reading it.
+	closeBulkFile := func() {
+		if err := bulkFile.Close(); err != nil {
+			slog.Warn("Could not close bulk data json file", "err", err)
+		}
+	}
+
+	hashes, err := l.cardRepository.ContentHashes(ctx)
+
+	if err != nil {
+		closeBulkFile()
+		return nil, fmt.Errorf("could not load card content hashes from database: %w", err)
+	}
+
+	// Content hashes are saved before Meilisearch confirms the cards, so after a
+	// failed or cancelled job they can match cards the live index never got.
+	lastSucceeded, err := l.metadataService.LastJobSucceeded(bulkData.Type, l.cfg.JobMode)
+
+	if err != nil {
+		closeBulkFile()
+		return nil, fmt.Errorf("could not get status of the previous job from database: %w", err)
+	}
+
+	if !lastSucceeded {
+		slog.Warn("Previous job did not succeed, treating every card as changed", "bulkType", bulkData.Type)
+	}
+
+	hasLiveIndex, err := l.meiliService.HasLiveIndex()
+
+	if err != nil {
+		closeBulkFile()
+		return nil, fmt.Errorf("could not check live index in meilisearch: %w", err)
+	}
+
+	fullRebuild := l.cfg.MeiliFullRebuild || !hasLiveIndex
+
+	if fullRebuild {
+		if err := l.meiliService.CreateStagingIndex(ctx); err != nil {
+			closeBulkFile()
+			return nil, fmt.Errorf("could not create staging index in meilisearch: %w", err)
+		}
+	}
+
+	if err := l.meiliService.UpdateIndexes(ctx); err != nil {
+		closeBulkFile()
+		return nil, fmt.Errorf("could not update meili index settings: %w", err)
+	}
+
+	filter := filters.NewCardFilter(l.filterRules)
+
+	// New releases only narrows change detection: older cards are not written
+	// even when they changed. They still count as seen, go into a rebuilt index
+	// and contribute their token links, so the rest of the catalog is kept.
+	var newReleases filters.CardFilter
+
+	if l.cfg.NewReleasesOnly {
+		latest, err := l.cardRepository.LatestReleaseDate(ctx)
+
+		if err != nil {
+			closeBulkFile()
+			return nil, fmt.Errorf("could not get latest release date from database: %w", err)
+		}
+
+		if latest != nil {
+			slog.Info("Loading new releases only", "releasedFrom", latest.Format(time.DateOnly))
+			newReleases = filters.NewCardFilter(l.filterRules.WithReleasedFrom(*latest))
+		}
+	}
+
+	// The tokens catalog is replaced as a whole, so it is not limited to new
+	// releases.
+	tokenFilter := filters.NewCardFilter(l.filterRules.WithLayouts(config.FilterList{Include: filters.TokenLayouts}))
+
+	start := time.Now()
+
+	jobID := uuid.NewString()
+
+	slog.Info("Started insertion job", "start", start, "jobId", jobID)
+
+	// jobCtx is cancelled with the first error that stops the job, which stops
+	// reading cards.
+	jobCtx, cancelJob := context.WithCancelCause(ctx)
+
+	defer cancelJob(nil)
+
+	cardsChannel := make(chan *objects.Card)
+
+	decodeErr := make(chan error, 1)
+
+	go func() { decodeErr <- sendToChannel(jobCtx, bulkFile, cardsChannel) }()
+
+	var cards []*objects.Card
+
+	var dbBatch []*models.Card
+
+	var seen []string
+
+	var tokens []*objects.Card
+
+	var tokenLinks []*models.CardToken
+
+	var cardsNew, cardsChanged, cardsUnchanged, tokensSaved int
+
+	var removed []string
+
+	saved := new(atomic.Int64)
+
+	failed := new(atomic.Int64)
+
+	// Row mode submits one card at a time, copy mode a batch.
+	failFast := l.cfg.DbFailurePolicy == config.FailurePolicyFailFast
+
+	writes := workers.NewPool(jobCtx, l.cfg.DbWorkers, failFast, func(ctx context.Context, batch []*models.Card) error {
+		if err := saveCards(ctx, l.cardRepository, l.cfg.DbIngestionMode, jobID, batch); err != nil {
+			failed.Add(int64(len(batch)))
+
+			// Stops the bulk file reader right away instead of at the next Submit.
+			if failFast {
+				cancelJob(err)
+			}
+
+			return err
+		}
+
+		saved.Add(int64(len(batch)))
+
+		return nil
+	})
+
+	end := start
+
+	result := func() *models.JobResult {
+		return &models.JobResult{
+			ID:             jobID,
+			Started:        start,
+			Finished:       end,
+			IngestionMode:  l.cfg.DbIngestionMode,
+			CardsSaved:     int(saved.Load()),
+			CardsFailed:    int(failed.Load()),
+			RowsPerSecond:  float64(saved.Load()) / end.Sub(start).Seconds(),
+			CardsRemoved:   len(removed),
+			CardsNew:       cardsNew,
+			CardsChanged:   cardsChanged,
+			CardsUnchanged: cardsUnchanged,
+			Rejections:     rejections(filter, tokenFilter, newReleases),
+			TokensSaved:    tokensSaved,
+		}
+	}
+
+	for card := range cardsChannel {
+		// The cards sent while the job was being cancelled are dropped.
+		if jobCtx.Err() != nil {
+			continue
+		}
+
+		if l.cfg.LoadTokens && slices.Contains(filters.TokenLayouts, card.Layout) {
+			if tokenFilter.Accept(card) {
+				tokens = append(tokens, card)
+				tokenLinks = append(tokenLinks, models.CardTokensFromJson(card, true)...)
+			}
+
+			continue
+		}
+
+		if !filter.Accept(card) {
+			continue
+		}
+
+		// Only accepted cards count as seen, so that cards a tightened filter now
+		// rejects are removed like the ones that left the bulk file.
+		seen = append(seen, card.ID)
+
+		if l.cfg.LoadTokens {
+			tokenLinks = append(tokenLinks, models.CardTokensFromJson(card, false)...)
+		}
+
+		entity := models.FromCardJson(card)
+
+		previousHash, exists := hashes[card.ID]
+
+		changed := !exists || previousHash != entity.ContentHash || l.cfg.FullReload || !lastSucceeded
+
+		switch {
+		case newReleases != nil && !newReleases.Accept(card):
+			changed = false
+		case !exists:
+			cardsNew++
+		case changed:
+			cardsChanged++
+		default:
+			cardsUnchanged++
+		}
+
+		// A full rebuild needs every card in the staging index, an incremental
+		// update of the live index only the ones that changed.
+		if changed || fullRebuild {
+			cards = append(cards, card)
+		}
+
+		if changed {
+			dbBatch = append(dbBatch, entity)
+
+			if l.cfg.DbIngestionMode != config.IngestionModeCopy || len(dbBatch) == l.cfg.DbCopyBatchSize {
+				if err := writes.Submit(dbBatch); err != nil {
+					cancelJob(err)
+				}
+
+				dbBatch = nil
+			}
+		}
+
+		if len(cards) == 100 {
+			// A failed batch is kept for the flush below, which retries it once the
+			// job is cancelled and no further cards are read.
+			if err := l.meiliService.SaveAll(jobCtx, cards); err != nil {
+				cancelJob(fmt.Errorf("could not save cards in meilisearch: %w", err))
+				continue
+			}
+
+			cards = nil
+		}
+	}
+
+	if err := <-decodeErr; err != nil {
+		cancelJob(err)
+	}
+
+	if len(dbBatch) != 0 {
+		if err := writes.Submit(dbBatch); err != nil {
+			cancelJob(err)
+		}
+
+		dbBatch = nil
+	}
+
+	// With the collect policy the job goes on after failed writes and only fails
+	// once everything else is done.
+	writeErr := writes.Wait()
+
+	if writeErr != nil && failFast {
+		cancelJob(writeErr)
+	}
+
+	// Flushed even after a failure, including a batch whose save failed above: the
+	// cards are already in the database, and their content hash would make the next
+	// run skip them. After a shutdown signal the flush is bounded by drainCtx instead.
+	flushCtx := ctx
+
+	if ctx.Err() != nil {
+		flushCtx = l.drainCtx
+	}
+
+	if len(cards) != 0 {
+		if err := l.meiliService.SaveAll(flushCtx, cards); err != nil {
+			cancelJob(fmt.Errorf("could not save remaining cards in meilisearch: %w", err))
+		}
+
+		cards = nil
+	}
+
+	end = time.Now()
+
+	slog.Info("Ended insertion job", "duration", end.Unix()-start.Unix(), "mode", l.cfg.DbIngestionMode, "workers", l.cfg.DbWorkers, "cards", saved.Load(), "failed", failed.Load(), "rowsPerSecond", float64(saved.Load())/end.Sub(start).Seconds(), "rejected", filter.Rejections())
+
+	if err := context.Cause(jobCtx); err != nil {
+		// A staging index is discarded, the live index keeps what was flushed.
+		if !fullRebuild {
+			if waitErr := l.meiliService.Wait(flushCtx); waitErr != nil {
+				slog.Warn("Meilisearch tasks of the interrupted job did not finish successfully", "err", waitErr)
+			}
+		}
+
+		return result(), err
+	}
+
+	if l.cfg.CardRemovalMode != config.RemovalModeDisabled {
+		removed, err = l.cardRepository.RemoveMissing(ctx, seen, l.cfg.CardRemovalMode == config.RemovalModeHard, l.cfg.CardRemovalMaxPercent)
+
+		if err != nil {
+			return result(), fmt.Errorf("could not remove cards missing from bulk data: %w", err)
+		}
+
+		slog.Info("Removed cards missing from bulk data", "mode", l.cfg.CardRemovalMode, "count", len(removed))
+	}
+
+	if _, err := l.cardRepository.TagBulkType(ctx, bulkData.Type, seen); err != nil {
+		return result(), fmt.Errorf("could not tag cards with bulk type %s: %w", bulkData.Type, err)
+	}
+
+	if l.cfg.LoadTokens {
+		if tokensSaved, err = l.saveTokens(ctx, tokens, tokenLinks); err != nil {
+			return result(), err
+		}
+	}
+
+	if err := l.meiliService.DeleteCards(ctx, removed); err != nil {
+		return result(), fmt.Errorf("could not remove cards from meilisearch: %w", err)
+	}
+
+	if fullRebuild {
+		// Keeping the previous index is better than swapping in one that was
+		// interrupted while settling.
+		if err := ctx.Err(); err != nil {
+			return result(), err
+		}
+
+		if err := l.meiliService.SwapIndexes(ctx); err != nil {
+			return result(), fmt.Errorf("could not swap staging index into live index: %w", err)
+		}
+
+		if err := l.meiliService.PruneIndexes(ctx); err != nil {
+			slog.Warn("Could not delete previous indexes", "error", err)
+		}
+	}
+
+	if err := l.meiliService.Wait(ctx); err != nil {
+		return result(), fmt.Errorf("meilisearch tasks did not finish successfully: %w", err)
+	}
+
+	if writeErr != nil {
+		return result(), fmt.Errorf("could not save %d cards in database: %w", failed.Load(), writeErr)
+	}
+
+	return result(), nil
+}
+
+// saveTokens replaces the tokens catalog and its search index with the tokens of
+// the bulk file and returns how many were saved.
+func (l *loader) saveTokens(ctx context.Context, tokens []*objects.Card, links []*models.CardToken) (int, error) {
+	entities := make([]*models.Token, 0, len(tokens))
+
+	for _, token := range tokens {
+		entities = append(entities, models.FromTokenJson(token))
+	}
+
+	removed, err := l.tokenRepository.Replace(ctx, entities, links, l.cfg.CardRemovalMode != config.RemovalModeDisabled)
+
+	if err != nil {
+		return 0, fmt.Errorf("could not save tokens in database: %w", err)
+	}
+
+	if err := l.meiliService.UpdateTokenIndex(ctx); err != nil {
+		return 0, fmt.Errorf("could not update meili token index settings: %w", err)
+	}
+
+	for start := 0; start < len(tokens); start += 100 {
+		if err := l.meiliService.SaveTokens(ctx, tokens[start:min(start+100, len(tokens))]); err != nil {
+			return 0, fmt.Errorf("could not save tokens in meilisearch: %w", err)
+		}
+	}
+
+	if err := l.meiliService.DeleteTokens(ctx, removed); err != nil {
+		return 0, fmt.Errorf("could not remove tokens from meilisearch: %w", err)
+	}
+
+	slog.Info("Loaded tokens", "tokens", len(tokens), "links", len(links), "removed", len(removed))
+
+	return len(tokens), nil
+}
+
+// rejections merges the rejection counts of the card and token filters, the
+// latter prefixed with "token_", with the older cards skipped by the new releases
+// filter, if any, under "new_releases_only".
+func rejections(filter filters.CardFilter, tokenFilter filters.CardFilter, newReleases filters.CardFilter) models.Rejections {
+	merged := models.Rejections(filter.Rejections())
+
+	for rule, count := range tokenFilter.Rejections() {
+		merged["token_"+rule] = count
+	}
+
+	if newReleases != nil {
+		for _, count := range newReleases.Rejections() {
+			merged["new_releases_only"] += count
+		}
+	}
+
+	return merged
+}
+
+// tagBulkType records which catalog cards are part of a secondary bulk file, such
+// as unique_artwork, without writing the cards themselves.
+func (l *loader) tagBulkType(ctx context.Context, bulkData *objects.BulkMetadata) (*models.JobResult, error) {
+	bulkFile, err := l.metadataService.OpenBulkFile(ctx, bulkData)
+
+	if err != nil {
+		return nil, fmt.Errorf("could not download bulk data from remote server: %w", err)
+	}
+
+	start := time.Now()
+
+	cardsChannel := make(chan *objects.Card)
+
+	decodeErr := make(chan error, 1)
+
+	go func() { decodeErr <- sendToChannel(ctx, bulkFile, cardsChannel) }()
+
+	var ids []string
+
+	for card := range cardsChannel {
+		ids = append(ids, card.ID)
+	}
+
+	// Tagging a partial list would untag the cards that were not read.
+	if err := <-decodeErr; err != nil {
+		return &models.JobResult{Started: start, IngestionMode: l.cfg.DbIngestionMode}, err
+	}
+
+	tagged, err := l.cardRepository.TagBulkType(ctx, bulkData.Type, ids)
+
+	if err != nil {
+		return &models.JobResult{Started: start, IngestionMode: l.cfg.DbIngestionMode}, fmt.Errorf("could not tag cards with bulk type: %w", err)
+	}
+
+	end := time.Now()
+
+	slog.Info("Tagged cards with bulk type", "bulkType", bulkData.Type, "cards", len(ids), "tagged", tagged, "notInCatalog", len(ids)-tagged)
+
+	return &models.JobResult{
+		Started:       start,
+		Finished:      end,
+		IngestionMode: l.cfg.DbIngestionMode,
+		CardsSaved:    tagged,
+		RowsPerSecond: float64(tagged) / end.Sub(start).Seconds(),
+	}, nil
+}
+
+// loadRulings replaces the stored rulings with the ones in the rulings bulk file.
+func (l *loader) loadRulings(ctx context.Context, bulkData *objects.BulkMetadata) (*models.JobResult, error) {
+	bulkFile, err := l.metadataService.OpenBulkFile(ctx, bulkData)
+
+	if err != nil {
+		return nil, fmt.Errorf("could not download bulk data from remote server: %w", err)
+	}
+
+	start := time.Now()
+
+	rulingsChannel := make(chan *objects.Ruling)
+
+	decodeErr := make(chan error, 1)
+
+	go func() { decodeErr <- sendToChannel(ctx, bulkFile, rulingsChannel) }()
+
+	var rulings []*models.Ruling
+
+	for raw := range rulingsChannel {
+		ruling, err := models.FromRulingJson(raw)
+
+		if err != nil {
+			slog.Warn("Skipping invalid ruling", "oracleId", raw.OracleID, "err", err)
+			continue
+		}
+
+		rulings = append(rulings, ruling)
+	}
+
+	// Replacing with a partial list would delete the rulings that were not read.
+	if err := <-decodeErr; err != nil {
+		return &models.JobResult{Started: start, IngestionMode: config.IngestionModeCopy}, err
+	}
+
+	counts, err := l.rulingRepository.Replace(ctx, rulings)
+
+	if err != nil {
+		return &models.JobResult{Started: start, IngestionMode: config.IngestionModeCopy}, fmt.Errorf("could not save rulings in database: %w", err)
+	}
+
+	end := time.Now()
+
+	slog.Info("Loaded rulings", "rulings", counts.Rulings, "duplicates", len(rulings)-counts.Rulings, "inserted", counts.Inserted, "unchanged", counts.Unchanged(), "removed", counts.Removed, "duration", end.Unix()-start.Unix())
+
+	// Rulings are always written with COPY, whatever DB_INGESTION_MODE says.
+	return &models.JobResult{
+		Started:        start,
+		Finished:       end,
+		IngestionMode:  config.IngestionModeCopy,
+		RowsPerSecond:  float64(counts.Rulings) / end.Sub(start).Seconds(),
+		RulingsSaved:   counts.Rulings,
+		RulingsNew:     counts.Inserted,
+		RulingsRemoved: counts.Removed,
+	}, nil
+}
+
+// loadPrices records the prices of the catalog cards in the bulk file for the day
+// the bulk file was generated. Card data is not written.
+func (l *loader) loadPrices(ctx context.Context, bulkData *objects.BulkMetadata) (*models.JobResult, error) {
+	bulkFile, err := l.metadataService.OpenBulkFile(ctx, bulkData)
+
+	if err != nil {
+		return nil, fmt.Errorf("could not download bulk data from remote server: %w", err)
+	}
+
+	start := time.Now()
+
+	// jobCtx is cancelled when a batch fails, which stops reading cards.
+	jobCtx, cancelJob := context.WithCancelCause(ctx)
+
+	defer cancelJob(nil)
+
+	cardsChannel := make(chan *objects.Card)
+
+	decodeErr := make(chan error, 1)
+
+	go func() { decodeErr <- sendToChannel(jobCtx, bulkFile, cardsChannel) }()
+
+	var batch []*models.CardPrice
+
+	var priced, saved int
+
+	result := func() *models.JobResult {
+		end := time.Now()
+
+		return &models.JobResult{
+			Started:       start,
+			Finished:      end,
+			IngestionMode: config.IngestionModeCopy,
+			CardsSaved:    saved,
+			RowsPerSecond: float64(saved) / end.Sub(start).Seconds(),
+			JobMode:       config.JobModePrices,
+		}
+	}
+
+	for card := range cardsChannel {
+		price := models.FromPricesJson(card.ID, bulkData.UpdatedAt, &card.Prices)
+
+		if !price.HasPrice() || jobCtx.Err() != nil {
+			continue
+		}
+
+		priced++
+
+		batch = append(batch, price)
+
+		if len(batch) == l.cfg.DbCopyBatchSize {
+			n, err := l.priceRepository.SaveAll(jobCtx, batch)
+
+			if err != nil {
+				cancelJob(fmt.Errorf("could not save prices in database: %w", err))
+			}
+
+			saved += n
+			batch = nil
+		}
+	}
+
+	if err := <-decodeErr; err != nil {
+		cancelJob(err)
+	}
+
+	if err := context.Cause(jobCtx); err != nil {
+		return result(), err
+	}
+
+	if len(batch) != 0 {
+		n, err := l.priceRepository.SaveAll(jobCtx, batch)
+
+		if err != nil {
+			return result(), fmt.Errorf("could not save prices in database: %w", err)
+		}
+
+		saved += n
+	}
+
+	slog.Info("Loaded prices", "priceDate", bulkData.UpdatedAt.UTC().Format(time.DateOnly), "priced", priced, "saved", saved, "notInCatalog", priced-saved)
+
+	return result(), nil
+}
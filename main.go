@@ -1,252 +1,316 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
+	"io"
 	"log/slog"
 	"os"
-	"sync"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/jmoiron/sqlx"
 	"spellscan.com/card-loader/config"
+	"spellscan.com/card-loader/filters"
+	"spellscan.com/card-loader/migrations"
 	"spellscan.com/card-loader/models"
 	"spellscan.com/card-loader/objects"
 	"spellscan.com/card-loader/services"
 )
 
-type semaphore chan struct{}
+const rulingsBulkType = "rulings"
 
-func (s semaphore) acquire() {
-	s <- struct{}{}
-}
-
-func (s semaphore) release() {
-	<-s
-}
-
-const max_semaphore = 100
+const migrateCommand = "migrate"
 
 func main() {
 	cfg := config.LoadConfig()
 
-	meiliClient := config.MeiliConnect(cfg)
-
-	meiliService := services.NewMeiliService(meiliClient)
-
 	db, err := config.DbConnect(cfg)
 
 	if err != nil {
 		os.Exit(1)
 	}
 
-	metadataService := services.NewMetadataService(db, cfg)
+	if len(os.Args) > 1 && os.Args[1] == migrateCommand {
+		migrate(db)
+		return
+	}
 
-	jobResult, err := metadataService.GetLastJobResult()
+	checkSchemaVersion(db)
+
+	filterConfig, err := config.LoadFilters(cfg)
 
 	if err != nil {
-		slog.Error("Could not get bulk metadata from database", "err", err)
+		slog.Error("Could not load card filters", "file", cfg.FiltersFile, "err", err)
 		os.Exit(1)
 	}
 
-	remoteBulkData, err := metadataService.GetRemoteBulkMetadata()
+	filterRules, err := filters.NewRules(filterConfig)
 
 	if err != nil {
-		slog.Error("Could not get bulk metadata from remote server", "err", err)
+		slog.Error("Could not validate card filters", "err", err)
 		os.Exit(1)
 	}
 
-	if remoteBulkData.Size == jobResult.Size {
-		slog.Info("Same data, nothing to do", "size", jobResult.Size)
-		return
-	}
+	meiliClient := config.MeiliConnect(cfg)
 
-	if err := metadataService.DownloadBulkFile(remoteBulkData); err != nil {
-		slog.Error("Could not download bulk metadata from remote server", "err", err)
-		os.Exit(1)
-	}
+	meiliService := services.NewMeiliService(meiliClient, cfg)
+
+	scryfallClient, err := config.ScryfallClient(cfg)
 
-	if err := meiliService.DeleteAll(); err != nil {
-		slog.Error("Could not delete data from meilisearch", "err", err)
+	if err != nil {
+		slog.Error("Could not configure scryfall client", "err", err)
 		os.Exit(1)
 	}
 
-	var releaseDateReference time.Time
+	metadataService := services.NewMetadataService(db, cfg, scryfallClient)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	defer cancel()
+
+	drainCtx, cancelDrain := context.WithCancel(context.Background())
+
+	defer cancelDrain()
+
+	go handleSignals(cancel, cancelDrain, cfg.ShutdownTimeout)
 
-	if cfg.UseReleaseDateReference {
-		rows, err := db.Query("SELECT max(released_at) FROM public.cards")
+	cardRepository := models.NewCardRepository(db, cfg.DbMaxRetries)
+
+	l := &loader{
+		cfg:              cfg,
+		meiliService:     meiliService,
+		metadataService:  metadataService,
+		cardRepository:   cardRepository,
+		rulingRepository: models.NewRulingRepository(db, cfg.DbMaxRetries),
+		setRepository:    models.NewSetRepository(db, cfg.DbMaxRetries),
+		priceRepository:  models.NewPriceRepository(db, cfg.DbMaxRetries),
+		tokenRepository:  models.NewTokenRepository(db, cfg.DbMaxRetries),
+		filterRules:      filterRules,
+		drainCtx:         drainCtx,
+	}
+
+	// Prices change daily without the cards changing, so they are loaded by a
+	// separate job that does not touch the catalog.
+	if cfg.JobMode == config.JobModePrices {
+		remoteBulkData, err := pendingBulkData(ctx, metadataService, cfg.BulkTypes[0], cfg.JobMode, false)
 
 		if err != nil {
-			slog.Warn("Could not fetch max release date from database", "error", err)
+			fatal(ctx, "Could not check bulk data", "bulkType", cfg.BulkTypes[0], "err", err)
 		}
 
-		if rows.Next() {
-			if err := rows.Scan(&releaseDateReference); err != nil {
-				slog.Warn("Could not fetch max release date from database", "error", err)
+		if remoteBulkData != nil {
+			if err := l.run(ctx, remoteBulkData, l.loadPrices); err != nil {
+				fatal(ctx, "Could not load prices", "bulkType", remoteBulkData.Type, "err", err)
 			}
 		}
-	}
-
-	start := time.Now()
-
-	slog.Info("Started insertion job", "start", start)
 
-	cardsChannel := make(chan *objects.Card)
+		return
+	}
 
-	go sendCardsToChannel(cardsChannel)
+	if err := l.loadSets(ctx); err != nil {
+		fatal(ctx, "Could not load sets", "err", err)
+	}
 
-	var cards []*objects.Card
+	catalogLoaded := false
 
-	wg := new(sync.WaitGroup)
+	for i, bulkType := range cfg.BulkTypes {
+		// Secondary types are re-applied after a catalog load so new cards get tagged.
+		remoteBulkData, err := pendingBulkData(ctx, metadataService, bulkType, cfg.JobMode, catalogLoaded || cfg.FullReload)
 
-	s := make(semaphore, max_semaphore)
+		if err != nil {
+			fatal(ctx, "Could not check bulk data", "bulkType", bulkType, "err", err)
+		}
 
-	for card := range cardsChannel {
-		if !isCardValid(card, &releaseDateReference) {
+		if remoteBulkData == nil {
 			continue
 		}
 
-		cards = append(cards, card)
-
-		wg.Add(1)
-		go saveCard(db, card, wg, &s)
-		s.acquire()
-
-		if len(cards) == 100 {
-			err := meiliService.SaveAll(cards)
-
-			if err != nil {
-				slog.Error("Could not save cards in meilisearch", "err", err)
-				os.Exit(1)
+		// The first bulk type is the catalog, the others only tag the cards they contain.
+		if i == 0 {
+			if err := l.run(ctx, remoteBulkData, l.loadCatalog); err != nil {
+				fatal(ctx, "Could not load cards", "bulkType", bulkType, "err", err)
 			}
 
-			cards = nil
+			catalogLoaded = true
+		} else if err := l.run(ctx, remoteBulkData, l.tagBulkType); err != nil {
+			fatal(ctx, "Could not tag cards with bulk type", "bulkType", bulkType, "err", err)
 		}
 	}
 
-	if len(cards) != 0 {
-		err := meiliService.SaveAll(cards)
+	if cfg.LoadRulings {
+		remoteBulkData, err := pendingBulkData(ctx, metadataService, rulingsBulkType, cfg.JobMode, false)
 
 		if err != nil {
-			slog.Error("Error while processing remanescent cards", "err", err)
-			os.Exit(1)
+			fatal(ctx, "Could not check bulk data", "bulkType", rulingsBulkType, "err", err)
+		}
+
+		if remoteBulkData != nil {
+			if err := l.run(ctx, remoteBulkData, l.loadRulings); err != nil {
+				fatal(ctx, "Could not load rulings", "err", err)
+			}
 		}
-		cards = nil
 	}
+}
 
-	wg.Wait()
+// handleSignals cancels the job on the first SIGINT or SIGTERM, so that it stops
+// taking work and rolls back its database writes. The Meilisearch drain is cancelled
+// after three quarters of timeout, leaving the rest to record the job result. A
+// second signal, or the job not stopping within timeout, exits right away.
+func handleSignals(cancel context.CancelFunc, cancelDrain context.CancelFunc, timeout time.Duration) {
+	signals := make(chan os.Signal, 2)
 
-	end := time.Now()
-	slog.Info("Ended insertion job", "duration", end.Unix()-start.Unix())
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
 
-	if err := meiliService.UpdateIndexes(); err != nil {
-		slog.Error("Could not update meili filter attributes", "error", err)
-		os.Exit(1)
-	}
+	sig := <-signals
 
-	if err := metadataService.Save(remoteBulkData, start, end); err != nil {
-		slog.Error("Could not save job result in database", "err", err)
-		os.Exit(1)
-	}
-}
+	slog.Warn("Shutting down, stopping in-flight work", "signal", sig.String(), "timeout", timeout)
 
-func saveCard(db *sqlx.DB, card *objects.Card, wg *sync.WaitGroup, s *semaphore) {
-	entity := models.FromCardJson(card)
+	cancel()
 
-	if err := entity.Save(db); err != nil {
-		slog.Error("Could not save card in database", "cardId", card.ID, "err", err.Error())
-		os.Exit(1)
-	}
+	time.AfterFunc(timeout-timeout/4, cancelDrain)
 
-	slog.Info("Saved", "cardId", card.ID)
+	select {
+	case sig = <-signals:
+		slog.Error("Received second signal, exiting", "signal", sig.String())
+	case <-time.After(timeout):
+		slog.Error("In-flight work did not finish before the shutdown timeout, exiting", "timeout", timeout)
+	}
 
-	s.release()
-	wg.Done()
+	os.Exit(1)
 }
 
-func isCardValid(card *objects.Card, releaseDateReference *time.Time) bool {
-	if card.Digital {
-		return false
+// fatal logs msg and exits. Failures caused by a shutdown signal are logged as
+// warnings, since they are expected.
+func fatal(ctx context.Context, msg string, args ...any) {
+	if ctx.Err() != nil {
+		slog.Warn(msg+", job cancelled", args...)
+	} else {
+		slog.Error(msg, args...)
 	}
 
-	if !hasSupportedLanguage(card.Lang) {
-		return false
-	}
-
-	if !hasSupportedLayout(card.Layout) {
-		return false
-	}
+	os.Exit(1)
+}
 
-	releasedAt, _ := time.Parse(time.DateOnly, card.ReleasedAt)
+// migrate applies the embedded migrations that the database is missing.
+func migrate(db *sqlx.DB) {
+	applied, err := migrations.Apply(db)
 
-	if releasedAt.After(time.Now()) {
-		return false
+	for _, migration := range applied {
+		slog.Info("Applied migration", "version", migration.Version, "name", migration.Name)
 	}
 
-	if releaseDateReference != nil {
-		if releasedAt.Unix() < releaseDateReference.Unix() {
-			return false
-		}
+	if err != nil {
+		slog.Error("Could not apply migrations", "err", err)
+		os.Exit(1)
 	}
 
-	return true
+	slog.Info("Database schema is up to date", "applied", len(applied))
 }
 
-func sendCardsToChannel(c chan *objects.Card) {
-	f, err := os.Open("./tmp/bulk_data.json")
+// checkSchemaVersion refuses to run against a database older than the models.
+func checkSchemaVersion(db *sqlx.DB) {
+	version, err := migrations.CurrentVersion(db)
 
 	if err != nil {
-		slog.Error("Could not open temp folder with bulk data json file", "err", err)
+		slog.Error("Could not get database schema version", "err", err)
 		os.Exit(1)
 	}
 
-	dec := json.NewDecoder(f)
+	if version < models.SchemaVersion {
+		slog.Error("Database schema is older than the loader expects, run the migrate command", "version", version, "expected", models.SchemaVersion)
+		os.Exit(1)
+	}
+}
 
-	_, err = dec.Token()
+// pendingBulkData returns the remote metadata of bulkType, or nil when the last
+// successful job of jobMode already loaded that version and force is false.
+func pendingBulkData(ctx context.Context, metadataService services.MetadataService, bulkType string, jobMode string, force bool) (*objects.BulkMetadata, error) {
+	jobResult, err := metadataService.GetLastJobResult(bulkType, jobMode)
 
 	if err != nil {
-		slog.Error("Could not decode token of bulk data json file", "err", err)
-		os.Exit(1)
+		return nil, fmt.Errorf("could not get bulk metadata from database: %w", err)
 	}
 
-	for dec.More() {
-		var card objects.Card
-		err := dec.Decode(&card)
-		if err != nil {
-			slog.Error("Could not decode json slice into card", "err", err)
-			os.Exit(1)
+	remoteBulkData, err := metadataService.GetRemoteBulkMetadata(ctx, bulkType)
+
+	if err != nil {
+		return nil, fmt.Errorf("could not get bulk metadata from remote server: %w", err)
+	}
+
+	if !force && remoteBulkData.ID == jobResult.BulkID && remoteBulkData.UpdatedAt.Equal(jobResult.ReferenceDate) {
+		slog.Info("Same data, nothing to do", "bulkType", bulkType, "bulkId", jobResult.BulkID, "updatedAt", jobResult.ReferenceDate)
+		return nil, nil
+	}
+
+	return remoteBulkData, nil
+}
+
+// saveCards writes cards with one COPY in copy ingestion mode, or with an upsert
+// per card in row mode.
+func saveCards(ctx context.Context, cardRepository models.CardRepository, ingestionMode string, jobID string, cards []*models.Card) error {
+	if ingestionMode == config.IngestionModeCopy {
+		if err := cardRepository.SaveAll(ctx, jobID, cards); err != nil {
+			return fmt.Errorf("could not copy %d cards starting at %s into database: %w", len(cards), cards[0].ID, err)
 		}
 
-		c <- &card
+		slog.Info("Saved batch", "firstCardId", cards[0].ID, "count", len(cards))
+
+		return nil
 	}
 
-	_, err = dec.Token()
+	for _, card := range cards {
+		if err := cardRepository.Save(ctx, jobID, card); err != nil {
+			return fmt.Errorf("could not save card %s in database: %w", card.ID, err)
+		}
 
-	if err != nil {
-		slog.Error("Could not decode token of bulk data json file", "err", err)
-		os.Exit(1)
+		slog.Info("Saved", "cardId", card.ID)
 	}
 
-	close(c)
+	return nil
 }
 
-func hasSupportedLayout(layout string) bool {
-	unsupportedLayouts := []string{"token", "emblem", "augment", "host", "vanguard", "reversible_card", "scheme", "art_series", "double_faced_token"}
+// sendToChannel decodes the JSON array in f and sends its objects to c until the
+// array ends or ctx is cancelled. It closes f and c when it returns.
+func sendToChannel[T any](ctx context.Context, f io.ReadCloser, c chan<- *T) error {
+	defer close(c)
 
-	for _, sl := range unsupportedLayouts {
-		if sl == layout {
-			return false
+	defer func() {
+		if err := f.Close(); err != nil {
+			slog.Warn("Could not close bulk data json file", "err", err)
 		}
+	}()
+
+	dec := json.NewDecoder(f)
+
+	if _, err := dec.Token(); err != nil {
+		return fmt.Errorf("could not decode token of bulk data json file: %w", err)
 	}
-	return true
-}
 
-func hasSupportedLanguage(lang string) bool {
-	supportedLanguages := []string{"en", "pt", "sp", "fr", "de", "it", "la"}
+	for dec.More() {
+		var object T
+
+		if err := dec.Decode(&object); err != nil {
+			return fmt.Errorf("could not decode json slice into object: %w", err)
+		}
 
-	for _, sl := range supportedLanguages {
-		if sl == lang {
-			return true
+		select {
+		case c <- &object:
+		case <-ctx.Done():
+			return ctx.Err()
 		}
 	}
-	return false
+
+	if _, err := dec.Token(); err != nil {
+		return fmt.Errorf("could not decode token of bulk data json file: %w", err)
+	}
+
+	// Drain the trailing whitespace so a streamed body is read up to EOF.
+	if _, err := io.Copy(io.Discard, f); err != nil {
+		return fmt.Errorf("could not read the end of bulk data json file: %w", err)
+	}
+
+	return nil
 }
@@ -0,0 +1,64 @@
+-- Schema previously provisioned by the spellscan-database image.
+
+CREATE TABLE IF NOT EXISTS cards (
+    id UUID PRIMARY KEY,
+    card_name VARCHAR(255) NOT NULL,
+    lang VARCHAR(10) NOT NULL,
+    released_at DATE NOT NULL,
+    layout VARCHAR(50) NOT NULL,
+    image_status VARCHAR(50),
+    mana_cost VARCHAR(255),
+    type_line VARCHAR(255),
+    printed_text TEXT,
+    colors TEXT[],
+    color_identity TEXT[],
+    reserved BOOLEAN NOT NULL DEFAULT FALSE,
+    finishes TEXT[],
+    promo BOOLEAN NOT NULL DEFAULT FALSE,
+    variation BOOLEAN NOT NULL DEFAULT FALSE,
+    card_set VARCHAR(10) NOT NULL,
+    rarity VARCHAR(50),
+    flavor_text TEXT,
+    artist VARCHAR(255),
+    frame VARCHAR(50),
+    full_art BOOLEAN NOT NULL DEFAULT FALSE,
+    textless BOOLEAN NOT NULL DEFAULT FALSE,
+    collector_number VARCHAR(50)
+);
+
+CREATE TABLE IF NOT EXISTS card_faces (
+    id UUID PRIMARY KEY,
+    card_id UUID NOT NULL REFERENCES cards (id),
+    card_name VARCHAR(255) NOT NULL,
+    mana_cost VARCHAR(255),
+    type_line VARCHAR(255),
+    printed_text TEXT,
+    flavor_text TEXT,
+    colors TEXT[],
+    color_indicator TEXT[]
+);
+
+CREATE INDEX IF NOT EXISTS card_faces_card_id_idx ON card_faces (card_id);
+
+CREATE TABLE IF NOT EXISTS image_uris (
+    id UUID PRIMARY KEY,
+    card_id UUID REFERENCES cards (id),
+    card_face_id UUID REFERENCES card_faces (id),
+    small_uri TEXT,
+    normal_uri TEXT,
+    large_uri TEXT,
+    png_uri TEXT,
+    art_crop_uri TEXT,
+    border_crop_uri TEXT
+);
+
+CREATE INDEX IF NOT EXISTS image_uris_card_id_idx ON image_uris (card_id);
+CREATE INDEX IF NOT EXISTS image_uris_card_face_id_idx ON image_uris (card_face_id);
+
+CREATE TABLE IF NOT EXISTS job_results (
+    id UUID PRIMARY KEY,
+    size BIGINT NOT NULL,
+    reference_date TIMESTAMP WITH TIME ZONE NOT NULL,
+    started TIMESTAMP WITH TIME ZONE NOT NULL,
+    finished TIMESTAMP WITH TIME ZONE NOT NULL
+);
@@ -0,0 +1,4 @@
+ALTER TABLE job_results
+    ADD COLUMN IF NOT EXISTS ingestion_mode VARCHAR(10) NOT NULL DEFAULT 'row',
+    ADD COLUMN IF NOT EXISTS cards_saved INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS rows_per_second DOUBLE PRECISION NOT NULL DEFAULT 0;
@@ -0,0 +1,5 @@
+ALTER TABLE cards
+    ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP WITH TIME ZONE;
+
+ALTER TABLE job_results
+    ADD COLUMN IF NOT EXISTS cards_removed INTEGER NOT NULL DEFAULT 0;
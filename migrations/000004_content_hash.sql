@@ -0,0 +1,8 @@
+ALTER TABLE cards
+    ADD COLUMN IF NOT EXISTS content_hash VARCHAR(64);
+
+ALTER TABLE job_results
+    ADD COLUMN IF NOT EXISTS bulk_id VARCHAR(36) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS cards_new INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS cards_changed INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS cards_unchanged INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,8 @@
+ALTER TABLE cards
+    ADD COLUMN IF NOT EXISTS bulk_types TEXT[] NOT NULL DEFAULT '{}';
+
+CREATE INDEX IF NOT EXISTS cards_bulk_types_idx ON cards USING GIN (bulk_types);
+
+-- Every job so far loaded the all_cards bulk file.
+ALTER TABLE job_results
+    ADD COLUMN IF NOT EXISTS bulk_type VARCHAR(50) NOT NULL DEFAULT 'all_cards';
@@ -0,0 +1,14 @@
+ALTER TABLE cards
+    ADD COLUMN IF NOT EXISTS oracle_id UUID;
+
+CREATE INDEX IF NOT EXISTS cards_oracle_id_idx ON cards (oracle_id);
+
+CREATE TABLE IF NOT EXISTS rulings (
+    id UUID PRIMARY KEY,
+    oracle_id UUID NOT NULL,
+    source VARCHAR(20) NOT NULL,
+    published_at DATE NOT NULL,
+    comment TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS rulings_oracle_id_idx ON rulings (oracle_id);
@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS sets (
+    id UUID PRIMARY KEY,
+    code VARCHAR(10) NOT NULL UNIQUE,
+    set_name VARCHAR(255) NOT NULL,
+    set_type VARCHAR(50) NOT NULL,
+    released_at DATE,
+    card_count INTEGER NOT NULL DEFAULT 0,
+    parent_set_code VARCHAR(10),
+    icon_svg_uri TEXT,
+    digital BOOLEAN NOT NULL DEFAULT FALSE
+);
+
+-- NOT VALID because existing cards predate the sets table; the loader fills it
+-- before writing cards, after which the constraint can be validated with
+-- ALTER TABLE cards VALIDATE CONSTRAINT cards_card_set_fkey.
+ALTER TABLE cards
+    ADD CONSTRAINT cards_card_set_fkey FOREIGN KEY (card_set) REFERENCES sets (code) NOT VALID;
@@ -0,0 +1,21 @@
+CREATE TABLE IF NOT EXISTS card_legalities (
+    card_id UUID NOT NULL REFERENCES cards (id),
+    format VARCHAR(50) NOT NULL,
+    status VARCHAR(20) NOT NULL,
+    PRIMARY KEY (card_id, format)
+);
+
+CREATE INDEX IF NOT EXISTS card_legalities_format_status_idx ON card_legalities (format, status);
+
+CREATE TABLE IF NOT EXISTS legality_changes (
+    id BIGSERIAL PRIMARY KEY,
+    job_id UUID NOT NULL,
+    card_id UUID NOT NULL,
+    format VARCHAR(50) NOT NULL,
+    previous_status VARCHAR(20) NOT NULL,
+    status VARCHAR(20) NOT NULL,
+    changed_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS legality_changes_card_id_idx ON legality_changes (card_id);
+CREATE INDEX IF NOT EXISTS legality_changes_job_id_idx ON legality_changes (job_id);
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS card_prices (
+    card_id UUID NOT NULL REFERENCES cards (id),
+    price_date DATE NOT NULL,
+    usd NUMERIC,
+    usd_foil NUMERIC,
+    usd_etched NUMERIC,
+    eur NUMERIC,
+    eur_foil NUMERIC,
+    tix NUMERIC,
+    PRIMARY KEY (card_id, price_date)
+);
+
+CREATE INDEX IF NOT EXISTS card_prices_price_date_idx ON card_prices (price_date);
+
+ALTER TABLE job_results ADD COLUMN IF NOT EXISTS job_mode VARCHAR(20) NOT NULL DEFAULT 'cards';
@@ -0,0 +1,22 @@
+ALTER TABLE cards
+    ADD COLUMN IF NOT EXISTS cmc NUMERIC,
+    ADD COLUMN IF NOT EXISTS power VARCHAR(10),
+    ADD COLUMN IF NOT EXISTS toughness VARCHAR(10),
+    ADD COLUMN IF NOT EXISTS loyalty VARCHAR(10),
+    ADD COLUMN IF NOT EXISTS keywords TEXT[],
+    ADD COLUMN IF NOT EXISTS produced_mana TEXT[],
+    ADD COLUMN IF NOT EXISTS multiverse_ids BIGINT[],
+    ADD COLUMN IF NOT EXISTS games TEXT[],
+    ADD COLUMN IF NOT EXISTS illustration_id UUID,
+    ADD COLUMN IF NOT EXISTS border_color VARCHAR(20),
+    ADD COLUMN IF NOT EXISTS security_stamp VARCHAR(20);
+
+CREATE INDEX IF NOT EXISTS cards_illustration_id_idx ON cards (illustration_id);
+CREATE INDEX IF NOT EXISTS cards_keywords_idx ON cards USING GIN (keywords);
+
+ALTER TABLE card_faces
+    ADD COLUMN IF NOT EXISTS power VARCHAR(10),
+    ADD COLUMN IF NOT EXISTS toughness VARCHAR(10),
+    ADD COLUMN IF NOT EXISTS loyalty VARCHAR(10),
+    ADD COLUMN IF NOT EXISTS artist VARCHAR(255),
+    ADD COLUMN IF NOT EXISTS illustration_id UUID;
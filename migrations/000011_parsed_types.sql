@@ -0,0 +1,10 @@
+ALTER TABLE cards
+    ADD COLUMN IF NOT EXISTS mana_symbols TEXT[],
+    ADD COLUMN IF NOT EXISTS mana_kinds TEXT[],
+    ADD COLUMN IF NOT EXISTS supertypes TEXT[],
+    ADD COLUMN IF NOT EXISTS card_types TEXT[],
+    ADD COLUMN IF NOT EXISTS subtypes TEXT[],
+    ADD COLUMN IF NOT EXISTS printed_subtypes TEXT[];
+
+CREATE INDEX IF NOT EXISTS cards_card_types_idx ON cards USING GIN (card_types);
+CREATE INDEX IF NOT EXISTS cards_subtypes_idx ON cards USING GIN (subtypes);
@@ -0,0 +1,2 @@
+ALTER TABLE job_results
+    ADD COLUMN IF NOT EXISTS rejections JSONB NOT NULL DEFAULT '{}';
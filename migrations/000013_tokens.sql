@@ -0,0 +1,65 @@
+CREATE TABLE IF NOT EXISTS tokens (
+    id UUID PRIMARY KEY,
+    oracle_id UUID,
+    card_name VARCHAR(255) NOT NULL,
+    lang VARCHAR(10) NOT NULL,
+    released_at DATE NOT NULL,
+    layout VARCHAR(50) NOT NULL,
+    mana_cost VARCHAR(255),
+    type_line VARCHAR(255),
+    printed_text TEXT,
+    colors TEXT[],
+    power VARCHAR(10),
+    toughness VARCHAR(10),
+    card_set VARCHAR(10) NOT NULL,
+    collector_number VARCHAR(50),
+    artist VARCHAR(255),
+    illustration_id UUID
+);
+
+CREATE TABLE IF NOT EXISTS token_faces (
+    id UUID PRIMARY KEY,
+    token_id UUID NOT NULL REFERENCES tokens (id),
+    card_name VARCHAR(255) NOT NULL,
+    mana_cost VARCHAR(255),
+    type_line VARCHAR(255),
+    printed_text TEXT,
+    flavor_text TEXT,
+    colors TEXT[],
+    color_indicator TEXT[],
+    power VARCHAR(10),
+    toughness VARCHAR(10),
+    loyalty VARCHAR(10),
+    artist VARCHAR(255),
+    illustration_id UUID
+);
+
+CREATE INDEX IF NOT EXISTS token_faces_token_id_idx ON token_faces (token_id);
+
+CREATE TABLE IF NOT EXISTS token_image_uris (
+    id UUID PRIMARY KEY,
+    token_id UUID REFERENCES tokens (id),
+    token_face_id UUID REFERENCES token_faces (id),
+    small_uri TEXT,
+    normal_uri TEXT,
+    large_uri TEXT,
+    png_uri TEXT,
+    art_crop_uri TEXT,
+    border_crop_uri TEXT
+);
+
+CREATE INDEX IF NOT EXISTS token_image_uris_token_id_idx ON token_image_uris (token_id);
+CREATE INDEX IF NOT EXISTS token_image_uris_token_face_id_idx ON token_image_uris (token_face_id);
+
+-- No foreign keys: all_parts can reference printings that are filtered out of
+-- the catalogs.
+CREATE TABLE IF NOT EXISTS card_tokens (
+    card_id UUID NOT NULL,
+    token_id UUID NOT NULL,
+    PRIMARY KEY (card_id, token_id)
+);
+
+CREATE INDEX IF NOT EXISTS card_tokens_token_id_idx ON card_tokens (token_id);
+
+ALTER TABLE job_results
+    ADD COLUMN IF NOT EXISTS tokens_saved INTEGER NOT NULL DEFAULT 0;
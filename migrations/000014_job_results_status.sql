@@ -0,0 +1,2 @@
+ALTER TABLE job_results
+    ADD COLUMN IF NOT EXISTS status VARCHAR(20) NOT NULL DEFAULT 'succeeded';
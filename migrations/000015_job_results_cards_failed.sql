@@ -0,0 +1,2 @@
+ALTER TABLE job_results
+    ADD COLUMN IF NOT EXISTS cards_failed INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,4 @@
+ALTER TABLE job_results
+    ADD COLUMN IF NOT EXISTS rulings_saved INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS rulings_new INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS rulings_removed INTEGER NOT NULL DEFAULT 0;
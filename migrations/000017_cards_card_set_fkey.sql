@@ -0,0 +1,12 @@
+-- Databases migrated with an edited 000007 skipped the foreign key when any table
+-- in any schema had a constraint of that name, so the check is scoped to cards.
+DO $$
+BEGIN
+    IF NOT EXISTS (
+        SELECT 1 FROM pg_constraint
+        WHERE conname = 'cards_card_set_fkey' AND conrelid = 'cards'::regclass
+    ) THEN
+        ALTER TABLE cards
+            ADD CONSTRAINT cards_card_set_fkey FOREIGN KEY (card_set) REFERENCES sets (code) NOT VALID;
+    END IF;
+END $$;
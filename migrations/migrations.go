@@ -0,0 +1,162 @@
+package migrations
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// migrationLockID serializes concurrent migrate runs with a transaction-scoped
+// advisory lock.
+const migrationLockID = 7318246519
+
+//go:embed *.sql
+var files embed.FS
+
+// Migration is one versioned SQL file, named {VERSION}_{NAME}.sql. Every file but
+// 000007, which adds a foreign key unconditionally, only uses IF NOT EXISTS style
+// statements, so it can be applied to a database whose schema was created before
+// the loader tracked versions. A released file is never
+// edited, as databases that recorded its version would not run it again.
+type Migration struct {
+	Version int
+	Name    string
+	SQL     string
+}
+
+// All returns the embedded migrations ordered by version.
+func All() ([]Migration, error) {
+	names, err := fs.Glob(files, "*.sql")
+
+	if err != nil {
+		return nil, err
+	}
+
+	var migrations []Migration
+
+	for _, name := range names {
+		prefix, rest, found := strings.Cut(name, "_")
+
+		version, err := strconv.Atoi(prefix)
+
+		if !found || err != nil {
+			return nil, fmt.Errorf("migration %s is not named {VERSION}_{NAME}.sql", name)
+		}
+
+		content, err := files.ReadFile(name)
+
+		if err != nil {
+			return nil, err
+		}
+
+		migrations = append(migrations, Migration{
+			Version: version,
+			Name:    strings.TrimSuffix(rest, ".sql"),
+			SQL:     string(content),
+		})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// CurrentVersion returns the version of the last migration applied to the
+// database, or 0 when none was.
+func CurrentVersion(db sqlx.Queryer) (int, error) {
+	var exists bool
+
+	if err := sqlx.Get(db, &exists, "SELECT to_regclass('schema_migrations') IS NOT NULL"); err != nil {
+		return 0, err
+	}
+
+	if !exists {
+		return 0, nil
+	}
+
+	var version int
+
+	if err := sqlx.Get(db, &version, "SELECT coalesce(max(version), 0) FROM schema_migrations"); err != nil {
+		return 0, err
+	}
+
+	return version, nil
+}
+
+// Apply runs every migration newer than the database version, each in its own
+// transaction, and returns the ones it applied.
+func Apply(db *sqlx.DB) ([]Migration, error) {
+	migrations, err := All()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := db.Exec(`
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name VARCHAR(255) NOT NULL,
+		applied_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+	)`); err != nil {
+		return nil, err
+	}
+
+	var applied []Migration
+
+	for _, migration := range migrations {
+		ok, err := apply(db, migration)
+
+		if err != nil {
+			return applied, fmt.Errorf("migration %d %s: %w", migration.Version, migration.Name, err)
+		}
+
+		if ok {
+			applied = append(applied, migration)
+		}
+	}
+
+	return applied, nil
+}
+
+func apply(db *sqlx.DB, migration Migration) (bool, error) {
+	tx, err := db.Beginx()
+
+	if err != nil {
+		return false, err
+	}
+
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("SELECT pg_advisory_xact_lock($1)", migrationLockID); err != nil {
+		return false, err
+	}
+
+	var exists bool
+
+	if err := tx.Get(&exists, "SELECT EXISTS (SELECT 1 FROM schema_migrations WHERE version = $1)", migration.Version); err != nil {
+		return false, err
+	}
+
+	if exists {
+		return false, nil
+	}
+
+	// Without arguments the whole file is sent as a single simple query, which
+	// allows several statements.
+	if _, err := tx.Exec(migration.SQL); err != nil {
+		return false, err
+	}
+
+	if _, err := tx.Exec("INSERT INTO schema_migrations (version, name) VALUES ($1, $2)", migration.Version, migration.Name); err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
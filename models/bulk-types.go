@@ -0,0 +1,44 @@
+package models
+
+import (
+	"context"
+
+	"github.com/jackc/pgx"
+)
+
+// tagBulkType makes bulkType part of cards.bulk_types for exactly the given ids
+// and returns how many of them exist in the catalog.
+func tagBulkType(ctx context.Context, conn *pgx.Conn, bulkType string, ids []string) (int, error) {
+	tx, err := conn.BeginEx(ctx, nil)
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer tx.Rollback()
+
+	if err := copyIds(tx, "tagged_cards", ids); err != nil {
+		return 0, err
+	}
+
+	queries := []string{
+		`UPDATE cards SET bulk_types = array_remove(bulk_types, $1)
+		WHERE $1 = ANY(bulk_types) AND id NOT IN (SELECT id FROM tagged_cards)`,
+		`UPDATE cards SET bulk_types = array_append(bulk_types, $1)
+		WHERE id IN (SELECT id FROM tagged_cards) AND NOT ($1 = ANY(bulk_types))`,
+	}
+
+	for _, query := range queries {
+		if _, err := tx.Exec(query, bulkType); err != nil {
+			return 0, err
+		}
+	}
+
+	var tagged int
+
+	if err := tx.QueryRow("SELECT count(*) FROM cards WHERE id IN (SELECT id FROM tagged_cards)").Scan(&tagged); err != nil {
+		return 0, err
+	}
+
+	return tagged, tx.CommitEx(ctx)
+}
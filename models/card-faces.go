@@ -3,7 +3,6 @@ package models
 import (
 	"database/sql"
 
-	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
 	"github.com/lib/pq"
 )
@@ -18,13 +17,15 @@ type CardFace struct {
 	FlavorText     string         `db:"flavor_text"`
 	Colors         pq.StringArray `db:"colors"`
 	ColorIndicator pq.StringArray `db:"color_indicator"`
+	Power          sql.NullString `db:"power"`
+	Toughness      sql.NullString `db:"toughness"`
+	Loyalty        sql.NullString `db:"loyalty"`
+	Artist         string         `db:"artist"`
+	IllustrationID sql.NullString `db:"illustration_id"`
 	ImageUris      *ImageUris     `db:"-"`
 }
 
-func (cf *CardFace) Save(db *sqlx.DB) error {
-	cf.ID = uuid.NewString()
-	cf.ImageUris.CardFaceId = sql.NullString{String: cf.ID, Valid: true}
-
+func (cf *CardFace) Save(db sqlx.Ext) error {
 	query := `
 	INSERT INTO card_faces (id, 
 		card_id,
@@ -34,7 +35,12 @@ func (cf *CardFace) Save(db *sqlx.DB) error {
 		printed_text,
 		flavor_text,
 		colors,
-		color_indicator)
+		color_indicator,
+		power,
+		toughness,
+		loyalty,
+		artist,
+		illustration_id)
 	VALUES (:id, 
 		:card_id, 
 		:card_name, 
@@ -43,11 +49,21 @@ func (cf *CardFace) Save(db *sqlx.DB) error {
 		:printed_text, 
 		:flavor_text, 
 		:colors, 
-		:color_indicator)
-	ON CONFLICT DO NOTHING
+		:color_indicator,
+		:power,
+		:toughness,
+		:loyalty,
+		:artist,
+		:illustration_id)
+	ON CONFLICT (id) DO UPDATE
+	SET card_id = EXCLUDED.card_id, card_name = EXCLUDED.card_name, mana_cost = EXCLUDED.mana_cost,
+		type_line = EXCLUDED.type_line, printed_text = EXCLUDED.printed_text, flavor_text = EXCLUDED.flavor_text,
+		colors = EXCLUDED.colors, color_indicator = EXCLUDED.color_indicator, power = EXCLUDED.power,
+		toughness = EXCLUDED.toughness, loyalty = EXCLUDED.loyalty, artist = EXCLUDED.artist,
+		illustration_id = EXCLUDED.illustration_id
 	`
 
-	if _, err := db.NamedExec(query, cf); err != nil {
+	if _, err := sqlx.NamedExec(db, query, cf); err != nil {
 		return err
 	}
 
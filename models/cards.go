@@ -1,11 +1,15 @@
 package models
 
 import (
+	"context"
 	"database/sql"
+	"log/slog"
+	"time"
 
 	"github.com/jmoiron/sqlx"
 	"github.com/lib/pq"
 	"spellscan.com/card-loader/objects"
+	"spellscan.com/card-loader/parsing"
 )
 
 type objectType int
@@ -14,50 +18,77 @@ const cardObject objectType = 1
 const cardFaceObject objectType = 2
 
 type Card struct {
-	ID              string         `db:"id"`
-	Name            string         `db:"card_name"`
-	Lang            string         `db:"lang"`
-	ReleasedAt      string         `db:"released_at"`
-	Layout          string         `db:"layout"`
-	ImageStatus     string         `db:"image_status"`
-	ImageUris       *ImageUris     `db:"-"`
-	CardFaces       []*CardFace    `db:"card_faces"`
-	ManaCost        string         `db:"mana_cost"`
-	TypeLine        string         `db:"type_line"`
-	PrintedText     string         `db:"printed_text"`
-	Colors          pq.StringArray `db:"colors"`
-	ColorIdentity   pq.StringArray `db:"color_identity"`
-	Reserved        bool           `db:"reserved"`
-	Finishes        pq.StringArray `db:"finishes"`
-	Promo           bool           `db:"promo"`
-	Variation       bool           `db:"variation"`
-	Set             string         `db:"card_set"`
-	Rarity          string         `db:"rarity"`
-	FlavorText      string         `db:"flavor_text"`
-	Artist          string         `db:"artist"`
-	Frame           string         `db:"frame"`
-	FullArt         bool           `db:"full_art"`
-	Textless        bool           `db:"textless"`
-	CollectorNumber string         `db:"collector_number"`
+	ID              string          `db:"id"`
+	OracleID        sql.NullString  `db:"oracle_id"`
+	Name            string          `db:"card_name"`
+	Lang            string          `db:"lang"`
+	ReleasedAt      string          `db:"released_at"`
+	Layout          string          `db:"layout"`
+	ImageStatus     string          `db:"image_status"`
+	ImageUris       *ImageUris      `db:"-"`
+	CardFaces       []*CardFace     `db:"card_faces"`
+	ManaCost        string          `db:"mana_cost"`
+	CMC             float64         `db:"cmc"`
+	TypeLine        string          `db:"type_line"`
+	PrintedText     string          `db:"printed_text"`
+	Power           sql.NullString  `db:"power"`
+	Toughness       sql.NullString  `db:"toughness"`
+	Loyalty         sql.NullString  `db:"loyalty"`
+	Colors          pq.StringArray  `db:"colors"`
+	ColorIdentity   pq.StringArray  `db:"color_identity"`
+	Keywords        pq.StringArray  `db:"keywords"`
+	ProducedMana    pq.StringArray  `db:"produced_mana"`
+	MultiverseIDs   pq.Int64Array   `db:"multiverse_ids"`
+	Games           pq.StringArray  `db:"games"`
+	ManaSymbols     pq.StringArray  `db:"mana_symbols"`
+	ManaKinds       pq.StringArray  `db:"mana_kinds"`
+	Supertypes      pq.StringArray  `db:"supertypes"`
+	CardTypes       pq.StringArray  `db:"card_types"`
+	Subtypes        pq.StringArray  `db:"subtypes"`
+	PrintedSubtypes pq.StringArray  `db:"printed_subtypes"`
+	Reserved        bool            `db:"reserved"`
+	Finishes        pq.StringArray  `db:"finishes"`
+	Promo           bool            `db:"promo"`
+	Variation       bool            `db:"variation"`
+	Set             string          `db:"card_set"`
+	Rarity          string          `db:"rarity"`
+	FlavorText      string          `db:"flavor_text"`
+	Artist          string          `db:"artist"`
+	IllustrationID  sql.NullString  `db:"illustration_id"`
+	BorderColor     string          `db:"border_color"`
+	SecurityStamp   sql.NullString  `db:"security_stamp"`
+	Frame           string          `db:"frame"`
+	FullArt         bool            `db:"full_art"`
+	Textless        bool            `db:"textless"`
+	CollectorNumber string          `db:"collector_number"`
+	ContentHash     string          `db:"content_hash"`
+	Legalities      []*CardLegality `db:"-"`
 }
 
-func (c *Card) Save(db *sqlx.DB) error {
+// Save upserts the card graph. Legality changes are attributed to jobID.
+func (c *Card) Save(db sqlx.Ext, jobID string) error {
 
 	query := `
-		INSERT INTO cards (id, card_name, lang, released_at, layout, image_status, 
+		INSERT INTO cards (id, oracle_id, card_name, lang, released_at, layout, image_status, 
 			mana_cost, type_line, printed_text, colors, color_identity,  
 			reserved, 
 			finishes,
 			promo, variation, card_set, rarity, flavor_text, 
-			artist, frame, full_art, textless, collector_number)
-		VALUES (:id, :card_name, :lang, :released_at, :layout, :image_status, 
+			artist, frame, full_art, textless, collector_number, content_hash,
+			cmc, power, toughness, loyalty, keywords, produced_mana, multiverse_ids, games,
+			illustration_id, border_color, security_stamp,
+			mana_symbols, mana_kinds, supertypes, card_types, subtypes, printed_subtypes)
+		VALUES (:id, :oracle_id, :card_name, :lang, :released_at, :layout, :image_status, 
 			:mana_cost, :type_line, :printed_text, :colors, :color_identity, 
 			:reserved, 
 			:finishes, 
 			:promo, :variation, :card_set, :rarity, :flavor_text, 
-			:artist, :frame, :full_art, :textless, :collector_number)
+			:artist, :frame, :full_art, :textless, :collector_number, :content_hash,
+			:cmc, :power, :toughness, :loyalty, :keywords, :produced_mana, :multiverse_ids, :games,
+			:illustration_id, :border_color, :security_stamp,
+			:mana_symbols, :mana_kinds, :supertypes, :card_types, :subtypes, :printed_subtypes)
 		ON CONFLICT (id) DO UPDATE
-		SET card_name = EXCLUDED.card_name, lang = EXCLUDED.lang, released_at = EXCLUDED.released_at,
+		SET oracle_id = EXCLUDED.oracle_id, card_name = EXCLUDED.card_name, lang = EXCLUDED.lang, released_at = EXCLUDED.released_at,
 			layout = EXCLUDED.layout, image_status = EXCLUDED.image_status,
 			mana_cost = EXCLUDED.mana_cost, type_line = EXCLUDED.type_line,
 			printed_text = EXCLUDED.printed_text, colors = EXCLUDED.colors, color_identity = EXCLUDED.color_identity,
@@ -65,10 +96,17 @@ func (c *Card) Save(db *sqlx.DB) error {
 			finishes = EXCLUDED.finishes,
 			promo = EXCLUDED.promo, variation = EXCLUDED.variation, card_set = EXCLUDED.card_set,
 			rarity = EXCLUDED.rarity, flavor_text = EXCLUDED.flavor_text, artist = EXCLUDED.artist, frame = EXCLUDED.frame,
-			full_art = EXCLUDED.full_art, textless = EXCLUDED.textless, collector_number = EXCLUDED.collector_number
+			full_art = EXCLUDED.full_art, textless = EXCLUDED.textless, collector_number = EXCLUDED.collector_number,
+			content_hash = EXCLUDED.content_hash, cmc = EXCLUDED.cmc, power = EXCLUDED.power,
+			toughness = EXCLUDED.toughness, loyalty = EXCLUDED.loyalty, keywords = EXCLUDED.keywords,
+			produced_mana = EXCLUDED.produced_mana, multiverse_ids = EXCLUDED.multiverse_ids, games = EXCLUDED.games,
+			illustration_id = EXCLUDED.illustration_id, border_color = EXCLUDED.border_color,
+			security_stamp = EXCLUDED.security_stamp, mana_symbols = EXCLUDED.mana_symbols,
+			mana_kinds = EXCLUDED.mana_kinds, supertypes = EXCLUDED.supertypes, card_types = EXCLUDED.card_types,
+			subtypes = EXCLUDED.subtypes, printed_subtypes = EXCLUDED.printed_subtypes, deleted_at = NULL
 		`
 
-	if _, err := db.NamedExec(query, c); err != nil {
+	if _, err := sqlx.NamedExec(db, query, c); err != nil {
 		return err
 	}
 
@@ -82,12 +120,64 @@ func (c *Card) Save(db *sqlx.DB) error {
 		}
 	}
 
+	if err := c.deleteStaleRows(db); err != nil {
+		return err
+	}
+
+	return c.saveLegalities(db, jobID)
+}
+
+// deleteStaleRows removes faces and image uris of the card that are no longer
+// present upstream, including rows left behind by runs that used random ids.
+func (c *Card) deleteStaleRows(db sqlx.Ext) error {
+	imageIds := pq.StringArray{c.ImageUris.ID}
+	faceIds := pq.StringArray{}
+
+	for _, cf := range c.CardFaces {
+		faceIds = append(faceIds, cf.ID)
+		imageIds = append(imageIds, cf.ImageUris.ID)
+	}
+
+	query := `
+	DELETE FROM image_uris
+	WHERE (card_id = $1 OR card_face_id IN (SELECT id FROM card_faces WHERE card_id = $1))
+		AND NOT (id::text = ANY($2::text[]))
+	`
+
+	if _, err := db.Exec(query, c.ID, imageIds); err != nil {
+		return err
+	}
+
+	query = `
+	DELETE FROM card_faces
+	WHERE card_id = $1 AND NOT (id::text = ANY($2::text[]))
+	`
+
+	if _, err := db.Exec(query, c.ID, faceIds); err != nil {
+		return err
+	}
+
 	return nil
 }
 
+func latestReleaseDate(ctx context.Context, db sqlx.QueryerContext) (*time.Time, error) {
+	var latest sql.NullTime
+
+	if err := sqlx.GetContext(ctx, db, &latest, "SELECT max(released_at) FROM cards WHERE deleted_at IS NULL"); err != nil {
+		return nil, err
+	}
+
+	if !latest.Valid {
+		return nil, nil
+	}
+
+	return &latest.Time, nil
+}
+
 func FromCardJson(card *objects.Card) *Card {
 	carddb := &Card{
 		ID:              card.ID,
+		OracleID:        optionalString(card.OracleID),
 		Name:            card.Name,
 		Lang:            card.Lang,
 		ReleasedAt:      card.ReleasedAt,
@@ -96,10 +186,18 @@ func FromCardJson(card *objects.Card) *Card {
 		ImageUris:       fromImageUrisJson(card.ID, &card.ImageUris, cardObject),
 		CardFaces:       fromCardFacesJson(card.ID, card.CardFaces),
 		ManaCost:        card.ManaCost,
+		CMC:             card.CMC,
 		TypeLine:        card.TypeLine,
 		PrintedText:     card.PrintedText,
+		Power:           optionalString(card.Power),
+		Toughness:       optionalString(card.Toughness),
+		Loyalty:         optionalString(card.Loyalty),
 		Colors:          card.Colors,
 		ColorIdentity:   card.ColorIdentity,
+		Keywords:        card.Keywords,
+		ProducedMana:    card.ProducedMana,
+		MultiverseIDs:   multiverseIDs(card.MultiverseIDs),
+		Games:           card.Games,
 		Reserved:        card.Reserved,
 		Finishes:        card.Finishes,
 		Promo:           card.Promo,
@@ -108,12 +206,30 @@ func FromCardJson(card *objects.Card) *Card {
 		Rarity:          card.Rarity,
 		FlavorText:      card.FlavorText,
 		Artist:          card.Artist,
+		IllustrationID:  optionalString(card.IllustrationID),
+		BorderColor:     card.BorderColor,
+		SecurityStamp:   optionalString(card.SecurityStamp),
 		Frame:           card.Frame,
 		FullArt:         card.FullArt,
 		Textless:        card.Textless,
 		CollectorNumber: card.CollectorNumber,
+		ContentHash:     ContentHash(card),
+		Legalities:      fromLegalitiesJson(card.ID, card.Legalities),
 	}
 
+	parsed, err := parsing.ParseCard(card)
+
+	if err != nil {
+		slog.Warn("Could not parse mana cost or type line", "cardId", card.ID, "err", err)
+	}
+
+	carddb.ManaSymbols = parsed.ManaCost.SymbolNames()
+	carddb.ManaKinds = parsed.ManaCost.Kinds()
+	carddb.Supertypes = parsed.TypeLine.Supertypes
+	carddb.CardTypes = parsed.TypeLine.Types
+	carddb.Subtypes = parsed.TypeLine.Subtypes
+	carddb.PrintedSubtypes = parsed.PrintedSubtypes
+
 	if card.PrintedName != "" {
 		carddb.Name = card.PrintedName
 	}
@@ -131,6 +247,7 @@ func FromCardJson(card *objects.Card) *Card {
 
 func fromImageUrisJson(objectId string, imageUris *objects.ImageUris, ot objectType) *ImageUris {
 	iu := &ImageUris{
+		ID:         imageUrisID(objectId),
 		Small:      imageUris.Small,
 		Normal:     imageUris.Normal,
 		Large:      imageUris.Large,
@@ -153,8 +270,11 @@ func fromImageUrisJson(objectId string, imageUris *objects.ImageUris, ot objectT
 func fromCardFacesJson(cardId string, cardFaces []objects.CardFace) []*CardFace {
 	var dbcf []*CardFace
 
-	for _, raw := range cardFaces {
+	for i, raw := range cardFaces {
+		id := cardFaceID(cardId, i)
+
 		entity := &CardFace{
+			ID:             id,
 			CardId:         cardId,
 			Name:           raw.Name,
 			ManaCost:       raw.ManaCost,
@@ -163,7 +283,12 @@ func fromCardFacesJson(cardId string, cardFaces []objects.CardFace) []*CardFace
 			FlavorText:     raw.FlavorText,
 			Colors:         raw.Colors,
 			ColorIndicator: raw.ColorIndicator,
-			ImageUris:      fromImageUrisJson("", &raw.ImageUris, cardFaceObject),
+			Power:          optionalString(raw.Power),
+			Toughness:      optionalString(raw.Toughness),
+			Loyalty:        optionalString(raw.Loyalty),
+			Artist:         raw.Artist,
+			IllustrationID: optionalString(raw.IllustrationID),
+			ImageUris:      fromImageUrisJson(id, &raw.ImageUris, cardFaceObject),
 		}
 
 		dbcf = append(dbcf, entity)
@@ -171,3 +296,23 @@ func fromCardFacesJson(cardId string, cardFaces []objects.CardFace) []*CardFace
 
 	return dbcf
 }
+
+// optionalString maps the empty strings Scryfall's missing fields decode to into
+// NULL.
+func optionalString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+func multiverseIDs(ids []int) pq.Int64Array {
+	if ids == nil {
+		return nil
+	}
+
+	converted := make(pq.Int64Array, 0, len(ids))
+
+	for _, id := range ids {
+		converted = append(converted, int64(id))
+	}
+
+	return converted
+}
@@ -0,0 +1,263 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"spellscan.com/card-loader/migrations"
+	"spellscan.com/card-loader/objects"
+	"spellscan.com/card-loader/workers"
+)
+
+// saveFuncs write cards the way the loader does in each ingestion mode.
+var saveFuncs = map[string]func(ctx context.Context, repo CardRepository, jobID string, cards []*Card) error{
+	"row": func(ctx context.Context, repo CardRepository, jobID string, cards []*Card) error {
+		for _, card := range cards {
+			if err := repo.Save(ctx, jobID, card); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	},
+	"copy": func(ctx context.Context, repo CardRepository, jobID string, cards []*Card) error {
+		return repo.SaveAll(ctx, jobID, cards)
+	},
+}
+
+func TestSaveIsRepeatable(t *testing.T) {
+	for mode, save := range saveFuncs {
+		t.Run(mode, func(t *testing.T) {
+			ctx := context.Background()
+
+			db := testDB(t)
+
+			repo := NewCardRepository(db, 0)
+
+			set := &Set{ID: uuid.NewString(), Code: "tst", Name: "Test", SetType: "expansion"}
+
+			if err := NewSetRepository(db, 0).SaveAll(ctx, []*Set{set}); err != nil {
+				t.Fatalf("could not save set: %v", err)
+			}
+
+			fixture := readFixture(t)
+
+			load := func() {
+				t.Helper()
+
+				cards := make([]*Card, 0, len(fixture))
+
+				for _, card := range fixture {
+					cards = append(cards, FromCardJson(card))
+				}
+
+				if err := save(ctx, repo, uuid.NewString(), cards); err != nil {
+					t.Fatalf("could not save cards: %v", err)
+				}
+			}
+
+			load()
+
+			faces, imageUris := rowIDs(t, db, "card_faces"), rowIDs(t, db, "image_uris")
+
+			// One image uris row per card and one per face.
+			if len(faces) != 2 || len(imageUris) != 4 {
+				t.Fatalf("first load wrote %d faces and %d image uris, want 2 and 4", len(faces), len(imageUris))
+			}
+
+			load()
+
+			if got := rowIDs(t, db, "card_faces"); !slices.Equal(got, faces) {
+				t.Errorf("second load changed card_faces ids from %v to %v", faces, got)
+			}
+
+			if got := rowIDs(t, db, "image_uris"); !slices.Equal(got, imageUris) {
+				t.Errorf("second load changed image_uris ids from %v to %v", imageUris, got)
+			}
+
+			transform := fixture[1]
+			staleFace := cardFaceID(transform.ID, 1)
+
+			transform.CardFaces = transform.CardFaces[:1]
+
+			load()
+
+			if got := rowIDs(t, db, "card_faces"); len(got) != 1 || slices.Contains(got, staleFace) {
+				t.Errorf("card_faces after dropping a face = %v, want only %s", got, cardFaceID(transform.ID, 0))
+			}
+
+			if got := rowIDs(t, db, "image_uris"); len(got) != 3 || slices.Contains(got, imageUrisID(staleFace)) {
+				t.Errorf("image_uris after dropping a face = %v, want the image uris of %s removed", got, staleFace)
+			}
+		})
+	}
+}
+
+// BenchmarkSavePool writes the same cards through write pools of several sizes,
+// like the loader does with DB_WORKERS, in both ingestion modes.
+func BenchmarkSavePool(b *testing.B) {
+	const cards, copyBatchSize = 2048, 32
+
+	ctx := context.Background()
+
+	db := testDB(b)
+
+	set := &Set{ID: uuid.NewString(), Code: "tst", Name: "Test", SetType: "expansion"}
+
+	if err := NewSetRepository(db, 0).SaveAll(ctx, []*Set{set}); err != nil {
+		b.Fatalf("could not save set: %v", err)
+	}
+
+	fixture := readFixture(b)
+
+	entities := make([]*Card, 0, cards)
+
+	for i := 0; i < cards; i++ {
+		card := *fixture[i%len(fixture)]
+		card.ID = uuid.NewString()
+
+		entities = append(entities, FromCardJson(&card))
+	}
+
+	repo := NewCardRepository(db, 0)
+
+	for mode, save := range saveFuncs {
+		batchSize := 1
+
+		if mode == "copy" {
+			batchSize = copyBatchSize
+		}
+
+		for _, size := range []int{1, 4, 16, 64} {
+			b.Run(fmt.Sprintf("mode=%s/workers=%d", mode, size), func(b *testing.B) {
+				db.SetMaxOpenConns(size)
+
+				jobID := uuid.NewString()
+
+				for i := 0; i < b.N; i++ {
+					pool := workers.NewPool(ctx, size, true, func(ctx context.Context, batch []*Card) error {
+						return save(ctx, repo, jobID, batch)
+					})
+
+					for start := 0; start < len(entities); start += batchSize {
+						if err := pool.Submit(entities[start:min(start+batchSize, len(entities))]); err != nil {
+							b.Fatal(err)
+						}
+					}
+
+					if err := pool.Wait(); err != nil {
+						b.Fatal(err)
+					}
+				}
+
+				b.ReportMetric(float64(b.N*len(entities))/b.Elapsed().Seconds(), "cards/s")
+			})
+		}
+	}
+}
+
+func readFixture(t testing.TB) []*objects.Card {
+	t.Helper()
+
+	data, err := os.ReadFile("testdata/cards.json")
+
+	if err != nil {
+		t.Fatalf("could not read fixture: %v", err)
+	}
+
+	var cards []*objects.Card
+
+	if err := json.Unmarshal(data, &cards); err != nil {
+		t.Fatalf("could not decode fixture: %v", err)
+	}
+
+	return cards
+}
+
+func rowIDs(t *testing.T, db *sqlx.DB, table string) []string {
+	t.Helper()
+
+	var ids []string
+
+	if err := db.Select(&ids, "SELECT id::text FROM "+table+" ORDER BY id"); err != nil {
+		t.Fatalf("could not list %s ids: %v", table, err)
+	}
+
+	return ids
+}
+
+// testDB migrates a throwaway schema on the Postgres server of TEST_DATABASE_DSN
+// and returns a connection that uses it. The schema is dropped when the test
+// ends, and the test is skipped when the variable is not set.
+func testDB(t testing.TB) *sqlx.DB {
+	t.Helper()
+
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_DSN is not set")
+	}
+
+	admin, err := sqlx.Connect("pgx", dsn)
+
+	if err != nil {
+		t.Fatalf("could not connect to test database: %v", err)
+	}
+
+	schema := fmt.Sprintf("card_loader_test_%d", time.Now().UnixNano())
+
+	if _, err := admin.Exec("CREATE SCHEMA " + schema); err != nil {
+		t.Fatalf("could not create schema %s: %v", schema, err)
+	}
+
+	t.Cleanup(func() {
+		if _, err := admin.Exec("DROP SCHEMA " + schema + " CASCADE"); err != nil {
+			t.Errorf("could not drop schema %s: %v", schema, err)
+		}
+
+		admin.Close()
+	})
+
+	db, err := sqlx.Connect("pgx", withSearchPath(dsn, schema))
+
+	if err != nil {
+		t.Fatalf("could not connect to schema %s: %v", schema, err)
+	}
+
+	t.Cleanup(func() { db.Close() })
+
+	if _, err := migrations.Apply(db); err != nil {
+		t.Fatalf("could not migrate schema %s: %v", schema, err)
+	}
+
+	return db
+}
+
+// withSearchPath sets the search_path runtime parameter of a URL or key/value
+// connection string.
+func withSearchPath(dsn string, schema string) string {
+	if !strings.HasPrefix(dsn, "postgres://") && !strings.HasPrefix(dsn, "postgresql://") {
+		return dsn + " search_path=" + schema
+	}
+
+	u, err := url.Parse(dsn)
+
+	if err != nil {
+		return dsn
+	}
+
+	query := u.Query()
+	query.Set("search_path", schema)
+	u.RawQuery = query.Encode()
+
+	return u.String()
+}
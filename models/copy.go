@@ -0,0 +1,263 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx"
+)
+
+// copyTable describes how a batch of rows is streamed into a temporary staging
+// table with COPY and then merged into its target table with a single upsert.
+type copyTable struct {
+	name    string
+	key     []string
+	columns []string
+	// owner is the column of a faces or image uris table referencing the card or
+	// token the row belongs to, and face the column of an image uris table
+	// referencing the face.
+	owner string
+	face  string
+}
+
+var cardsCopyTable = copyTable{
+	name: "cards",
+	columns: []string{"id", "oracle_id", "card_name", "lang", "released_at", "layout", "image_status",
+		"mana_cost", "type_line", "printed_text", "colors", "color_identity",
+		"reserved", "finishes", "promo", "variation", "card_set", "rarity", "flavor_text",
+		"artist", "frame", "full_art", "textless", "collector_number", "content_hash", "deleted_at",
+		"cmc", "power", "toughness", "loyalty", "keywords", "produced_mana", "multiverse_ids", "games",
+		"illustration_id", "border_color", "security_stamp",
+		"mana_symbols", "mana_kinds", "supertypes", "card_types", "subtypes", "printed_subtypes"},
+}
+
+var cardFacesCopyTable = copyTable{
+	name:  "card_faces",
+	owner: "card_id",
+	columns: []string{"id", "card_id", "card_name", "mana_cost", "type_line",
+		"printed_text", "flavor_text", "colors", "color_indicator",
+		"power", "toughness", "loyalty", "artist", "illustration_id"},
+}
+
+var imageUrisCopyTable = copyTable{
+	name:  "image_uris",
+	owner: "card_id",
+	face:  "card_face_id",
+	columns: []string{"id", "card_id", "card_face_id", "small_uri", "normal_uri",
+		"large_uri", "png_uri", "art_crop_uri", "border_crop_uri"},
+}
+
+func (t copyTable) staging() string {
+	return t.name + "_staging"
+}
+
+func (t copyTable) createStagingQuery() string {
+	return fmt.Sprintf("CREATE TEMPORARY TABLE %s (LIKE %s INCLUDING DEFAULTS) ON COMMIT DROP", t.staging(), t.name)
+}
+
+func (t copyTable) mergeQuery() string {
+	columns := strings.Join(t.columns, ", ")
+
+	key := t.key
+
+	if key == nil {
+		key = []string{"id"}
+	}
+
+	var updates []string
+
+	for _, column := range t.columns {
+		if !slices.Contains(key, column) {
+			updates = append(updates, column+" = EXCLUDED."+column)
+		}
+	}
+
+	return fmt.Sprintf("INSERT INTO %s (%s) SELECT %s FROM %s ON CONFLICT (%s) DO UPDATE SET %s",
+		t.name, columns, columns, t.staging(), strings.Join(key, ", "), strings.Join(updates, ", "))
+}
+
+// graphTables are the tables of objects stored with their faces and image uris,
+// the cards and the tokens catalogs.
+type graphTables struct {
+	owners copyTable
+	faces  copyTable
+	images copyTable
+}
+
+var cardGraphTables = graphTables{owners: cardsCopyTable, faces: cardFacesCopyTable, images: imageUrisCopyTable}
+
+// graphRows are the copy rows of a batch of objects for their graphTables.
+type graphRows struct {
+	owners [][]interface{}
+	faces  [][]interface{}
+	images [][]interface{}
+}
+
+func (r *graphRows) add(owner []interface{}, imageUris *ImageUris, faces []*CardFace) {
+	r.owners = append(r.owners, owner)
+	r.images = append(r.images, imageUris.copyValues())
+
+	for _, cf := range faces {
+		r.faces = append(r.faces, cf.copyValues())
+		r.images = append(r.images, cf.ImageUris.copyValues())
+	}
+}
+
+// merge copies rows into staging tables and upserts them, then deletes the faces
+// and image uris of the merged objects that are no longer present. The staging
+// tables live until tx ends.
+func (g graphTables) merge(tx *pgx.Tx, rows graphRows) error {
+	copies := []struct {
+		table copyTable
+		rows  [][]interface{}
+	}{
+		{g.owners, rows.owners},
+		{g.faces, rows.faces},
+		{g.images, rows.images},
+	}
+
+	for _, c := range copies {
+		if _, err := tx.Exec(c.table.createStagingQuery()); err != nil {
+			return err
+		}
+
+		if _, err := tx.CopyFrom(pgx.Identifier{c.table.staging()}, c.table.columns, pgx.CopyFromRows(c.rows)); err != nil {
+			return err
+		}
+	}
+
+	merged := fmt.Sprintf("SELECT id FROM %s", g.owners.staging())
+
+	// Faces must exist before their images, and stale images must go before
+	// their stale faces.
+	queries := []string{
+		g.owners.mergeQuery(),
+		g.faces.mergeQuery(),
+		fmt.Sprintf(`DELETE FROM %s
+		WHERE (%s IN (%s)
+			OR %s IN (SELECT id FROM %s WHERE %s IN (%s)))
+			AND id NOT IN (SELECT id FROM %s)`,
+			g.images.name, g.images.owner, merged, g.images.face, g.faces.name, g.faces.owner, merged, g.images.staging()),
+		fmt.Sprintf(`DELETE FROM %s
+		WHERE %s IN (%s)
+			AND id NOT IN (SELECT id FROM %s)`,
+			g.faces.name, g.faces.owner, merged, g.faces.staging()),
+		g.images.mergeQuery(),
+	}
+
+	for _, query := range queries {
+		if _, err := tx.Exec(query); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// copyCards writes a batch of card graphs with COPY inside a single transaction.
+func copyCards(ctx context.Context, conn *pgx.Conn, jobID string, cards []*Card) error {
+	var rows graphRows
+
+	var legalityRows [][]interface{}
+
+	for _, c := range cards {
+		row, err := c.copyValues()
+
+		if err != nil {
+			return err
+		}
+
+		rows.add(row, c.ImageUris, c.CardFaces)
+
+		for _, l := range c.Legalities {
+			legalityRows = append(legalityRows, []interface{}{l.CardId, l.Format, l.Status})
+		}
+	}
+
+	tx, err := conn.BeginEx(ctx, nil)
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	if err := cardGraphTables.merge(tx, rows); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(cardLegalitiesCopyTable.createStagingQuery()); err != nil {
+		return err
+	}
+
+	if _, err := tx.CopyFrom(pgx.Identifier{cardLegalitiesCopyTable.staging()}, cardLegalitiesCopyTable.columns, pgx.CopyFromRows(legalityRows)); err != nil {
+		return err
+	}
+
+	// Legality changes are logged against the stored statuses before the merge.
+	_, err = tx.Exec(`INSERT INTO legality_changes (job_id, card_id, format, previous_status, status)
+		SELECT $1, l.card_id, l.format, l.status, s.status
+		FROM card_legalities l
+		JOIN card_legalities_staging s ON s.card_id = l.card_id AND s.format = l.format
+		WHERE l.status <> s.status`, jobID)
+
+	if err != nil {
+		return err
+	}
+
+	queries := []string{
+		cardLegalitiesCopyTable.mergeQuery(),
+		`DELETE FROM card_legalities l
+		WHERE l.card_id IN (SELECT id FROM cards_staging)
+			AND NOT EXISTS (SELECT 1 FROM card_legalities_staging s WHERE s.card_id = l.card_id AND s.format = l.format)`,
+	}
+
+	for _, query := range queries {
+		if _, err := tx.Exec(query); err != nil {
+			return err
+		}
+	}
+
+	return tx.CommitEx(ctx)
+}
+
+func (c *Card) copyValues() ([]interface{}, error) {
+	releasedAt, err := time.Parse(time.DateOnly, c.ReleasedAt)
+
+	if err != nil {
+		return nil, fmt.Errorf("card %s has invalid released_at: %w", c.ID, err)
+	}
+
+	return []interface{}{c.ID, nullString(c.OracleID), c.Name, c.Lang, releasedAt, c.Layout, c.ImageStatus,
+		c.ManaCost, c.TypeLine, c.PrintedText, []string(c.Colors), []string(c.ColorIdentity),
+		c.Reserved, []string(c.Finishes), c.Promo, c.Variation, c.Set, c.Rarity, c.FlavorText,
+		c.Artist, c.Frame, c.FullArt, c.Textless, c.CollectorNumber, c.ContentHash, nil,
+		c.CMC, nullString(c.Power), nullString(c.Toughness), nullString(c.Loyalty), []string(c.Keywords),
+		[]string(c.ProducedMana), []int64(c.MultiverseIDs), []string(c.Games),
+		nullString(c.IllustrationID), c.BorderColor, nullString(c.SecurityStamp),
+		[]string(c.ManaSymbols), []string(c.ManaKinds), []string(c.Supertypes), []string(c.CardTypes),
+		[]string(c.Subtypes), []string(c.PrintedSubtypes)}, nil
+}
+
+func (cf *CardFace) copyValues() []interface{} {
+	return []interface{}{cf.ID, cf.CardId, cf.Name, cf.ManaCost, cf.TypeLine,
+		cf.PrintedText, cf.FlavorText, []string(cf.Colors), []string(cf.ColorIndicator),
+		nullString(cf.Power), nullString(cf.Toughness), nullString(cf.Loyalty), cf.Artist, nullString(cf.IllustrationID)}
+}
+
+func (iu *ImageUris) copyValues() []interface{} {
+	return []interface{}{iu.ID, nullString(iu.CardId), nullString(iu.CardFaceId), iu.Small, iu.Normal,
+		iu.Large, iu.Png, iu.ArtCrop, iu.BorderCrop}
+}
+
+func nullString(s sql.NullString) interface{} {
+	if !s.Valid {
+		return nil
+	}
+
+	return s.String
+}
@@ -0,0 +1,59 @@
+package models
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+
+	"github.com/jmoiron/sqlx"
+	"spellscan.com/card-loader/objects"
+)
+
+// contentHashVersion is part of every content hash. Bump it whenever the mapping
+// from objects.Card to the database or search documents changes, so that every
+// card is rewritten on the next run.
+const contentHashVersion = "6"
+
+// ContentHash fingerprints the parts of a card the loader persists. Fields that
+// change daily without the card itself changing, such as prices and ranks, are
+// left out.
+func ContentHash(card *objects.Card) string {
+	normalized := *card
+	normalized.Prices = objects.Prices{}
+	normalized.EdhrecRank = 0
+	normalized.PennyRank = 0
+	normalized.PurchaseUris = objects.PurchaseUris{}
+	normalized.RelatedUris = objects.RelatedUris{}
+
+	// objects.Card only holds values that always marshal.
+	payload, _ := json.Marshal(&normalized)
+
+	sum := sha256.Sum256(append([]byte(contentHashVersion+":"), payload...))
+
+	return hex.EncodeToString(sum[:])
+}
+
+func loadContentHashes(ctx context.Context, db sqlx.QueryerContext) (map[string]string, error) {
+	rows, err := db.QueryxContext(ctx, "SELECT id::text, coalesce(content_hash, '') FROM cards WHERE deleted_at IS NULL")
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	hashes := make(map[string]string)
+
+	for rows.Next() {
+		var id, hash string
+
+		if err := rows.Scan(&id, &hash); err != nil {
+			return nil, err
+		}
+
+		hashes[id] = hash
+	}
+
+	return hashes, rows.Err()
+}
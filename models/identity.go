@@ -0,0 +1,19 @@
+package models
+
+import (
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+// identityNamespace scopes the name-based UUIDs of rows derived from a card, so
+// that re-running the loader over the same bulk file yields the same ids.
+var identityNamespace = uuid.MustParse("6f1c7b8e-3f0a-4d8a-9a55-0c2f5b9d7e41")
+
+func cardFaceID(cardId string, index int) string {
+	return uuid.NewSHA1(identityNamespace, []byte(fmt.Sprintf("%s/card_faces/%d", cardId, index))).String()
+}
+
+func imageUrisID(ownerId string) string {
+	return uuid.NewSHA1(identityNamespace, []byte(ownerId+"/image_uris")).String()
+}
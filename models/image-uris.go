@@ -3,7 +3,6 @@ package models
 import (
 	"database/sql"
 
-	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
 )
 
@@ -19,9 +18,7 @@ type ImageUris struct {
 	BorderCrop string         `db:"border_crop_uri"`
 }
 
-func (iu *ImageUris) Save(db *sqlx.DB) error {
-	iu.ID = uuid.NewString()
-
+func (iu *ImageUris) Save(db sqlx.Ext) error {
 	query := `
 	INSERT INTO image_uris (id, 
 		card_id, 
@@ -41,9 +38,13 @@ func (iu *ImageUris) Save(db *sqlx.DB) error {
 		:png_uri, 
 		:art_crop_uri, 
 		:border_crop_uri)
+	ON CONFLICT (id) DO UPDATE
+	SET card_id = EXCLUDED.card_id, card_face_id = EXCLUDED.card_face_id,
+		small_uri = EXCLUDED.small_uri, normal_uri = EXCLUDED.normal_uri, large_uri = EXCLUDED.large_uri,
+		png_uri = EXCLUDED.png_uri, art_crop_uri = EXCLUDED.art_crop_uri, border_crop_uri = EXCLUDED.border_crop_uri
 	`
 
-	if _, err := db.NamedExec(query, iu); err != nil {
+	if _, err := sqlx.NamedExec(db, query, iu); err != nil {
 		return err
 	}
 
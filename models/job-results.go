@@ -1,6 +1,9 @@
 package models
 
 import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
 	"time"
 
 	"github.com/google/uuid"
@@ -8,30 +11,118 @@ import (
 )
 
 type JobResult struct {
-	ID            string    `db:"id"`
-	Size          int       `db:"size"`
-	ReferenceDate time.Time `db:"reference_date"`
-	Started       time.Time `db:"started"`
-	Finished      time.Time `db:"finished"`
+	ID             string     `db:"id"`
+	Size           int        `db:"size"`
+	ReferenceDate  time.Time  `db:"reference_date"`
+	Started        time.Time  `db:"started"`
+	Finished       time.Time  `db:"finished"`
+	IngestionMode  string     `db:"ingestion_mode"`
+	CardsSaved     int        `db:"cards_saved"`
+	RowsPerSecond  float64    `db:"rows_per_second"`
+	CardsRemoved   int        `db:"cards_removed"`
+	BulkID         string     `db:"bulk_id"`
+	BulkType       string     `db:"bulk_type"`
+	CardsNew       int        `db:"cards_new"`
+	CardsChanged   int        `db:"cards_changed"`
+	CardsUnchanged int        `db:"cards_unchanged"`
+	JobMode        string     `db:"job_mode"`
+	Rejections     Rejections `db:"rejections"`
+	TokensSaved    int        `db:"tokens_saved"`
+	Status         string     `db:"status"`
+	CardsFailed    int        `db:"cards_failed"`
+	RulingsSaved   int        `db:"rulings_saved"`
+	RulingsNew     int        `db:"rulings_new"`
+	RulingsRemoved int        `db:"rulings_removed"`
 }
 
-func (j *JobResult) Save(db *sqlx.DB) error {
-	j.ID = uuid.NewString()
+const (
+	JobStatusSucceeded = "succeeded"
+	JobStatusFailed    = "failed"
+	JobStatusCancelled = "cancelled"
+)
+
+// Rejections counts the cards of a job rejected by each filter rule.
+type Rejections map[string]int
+
+func (r Rejections) Value() (driver.Value, error) {
+	if r == nil {
+		return []byte("{}"), nil
+	}
+
+	return json.Marshal(r)
+}
+
+func (r *Rejections) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*r = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(v, r)
+	case string:
+		return json.Unmarshal([]byte(v), r)
+	default:
+		return fmt.Errorf("cannot scan %T into Rejections", src)
+	}
+}
+
+func (j *JobResult) Save(db sqlx.Ext) error {
+	if j.ID == "" {
+		j.ID = uuid.NewString()
+	}
+
+	if j.Status == "" {
+		j.Status = JobStatusSucceeded
+	}
 
 	query := `
 	INSERT INTO job_results (id,
 		size,
 		reference_date,
 		started,
-		finished)
+		finished,
+		ingestion_mode,
+		cards_saved,
+		rows_per_second,
+		cards_removed,
+		bulk_id,
+		bulk_type,
+		cards_new,
+		cards_changed,
+		cards_unchanged,
+		job_mode,
+		rejections,
+		tokens_saved,
+		status,
+		cards_failed,
+		rulings_saved,
+		rulings_new,
+		rulings_removed)
 	VALUES (:id,
 		:size,
 		:reference_date,
 		:started,
-		:finished)
+		:finished,
+		:ingestion_mode,
+		:cards_saved,
+		:rows_per_second,
+		:cards_removed,
+		:bulk_id,
+		:bulk_type,
+		:cards_new,
+		:cards_changed,
+		:cards_unchanged,
+		:job_mode,
+		:rejections,
+		:tokens_saved,
+		:status,
+		:cards_failed,
+		:rulings_saved,
+		:rulings_new,
+		:rulings_removed)
 	`
 
-	if _, err := db.NamedExec(query, j); err != nil {
+	if _, err := sqlx.NamedExec(db, query, j); err != nil {
 		return err
 	}
 
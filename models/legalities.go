@@ -0,0 +1,83 @@
+package models
+
+import (
+	"sort"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"spellscan.com/card-loader/objects"
+)
+
+type CardLegality struct {
+	CardId string `db:"card_id"`
+	Format string `db:"format"`
+	Status string `db:"status"`
+}
+
+var cardLegalitiesCopyTable = copyTable{
+	name:    "card_legalities",
+	key:     []string{"card_id", "format"},
+	columns: []string{"card_id", "format", "status"},
+}
+
+func fromLegalitiesJson(cardId string, legalities objects.Legalities) []*CardLegality {
+	formats := make([]string, 0, len(legalities))
+
+	for format := range legalities {
+		formats = append(formats, format)
+	}
+
+	sort.Strings(formats)
+
+	var entities []*CardLegality
+
+	for _, format := range formats {
+		entities = append(entities, &CardLegality{CardId: cardId, Format: format, Status: legalities[format]})
+	}
+
+	return entities
+}
+
+// saveLegalities upserts the legalities of the card, logging every status that
+// differs from the stored one as a change made by jobID.
+func (c *Card) saveLegalities(db sqlx.Ext, jobID string) error {
+	formats := pq.StringArray{}
+	statuses := pq.StringArray{}
+
+	for _, l := range c.Legalities {
+		formats = append(formats, l.Format)
+		statuses = append(statuses, l.Status)
+	}
+
+	query := `
+	INSERT INTO legality_changes (job_id, card_id, format, previous_status, status)
+	SELECT $1, l.card_id, l.format, l.status, n.status
+	FROM card_legalities l
+	JOIN unnest($3::text[], $4::text[]) AS n (format, status) ON n.format = l.format
+	WHERE l.card_id = $2 AND l.status <> n.status
+	`
+
+	if _, err := db.Exec(query, jobID, c.ID, formats, statuses); err != nil {
+		return err
+	}
+
+	query = `
+	INSERT INTO card_legalities (card_id, format, status)
+	SELECT $1, n.format, n.status FROM unnest($2::text[], $3::text[]) AS n (format, status)
+	ON CONFLICT (card_id, format) DO UPDATE SET status = EXCLUDED.status
+	`
+
+	if _, err := db.Exec(query, c.ID, formats, statuses); err != nil {
+		return err
+	}
+
+	query = `
+	DELETE FROM card_legalities WHERE card_id = $1 AND NOT (format = ANY($2::text[]))
+	`
+
+	if _, err := db.Exec(query, c.ID, formats); err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,108 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx"
+	"github.com/shopspring/decimal"
+	"spellscan.com/card-loader/objects"
+)
+
+type CardPrice struct {
+	CardID    string              `db:"card_id"`
+	PriceDate time.Time           `db:"price_date"`
+	Usd       decimal.NullDecimal `db:"usd"`
+	UsdFoil   decimal.NullDecimal `db:"usd_foil"`
+	UsdEtched decimal.NullDecimal `db:"usd_etched"`
+	Eur       decimal.NullDecimal `db:"eur"`
+	EurFoil   decimal.NullDecimal `db:"eur_foil"`
+	Tix       decimal.NullDecimal `db:"tix"`
+}
+
+var cardPricesCopyTable = copyTable{
+	name:    "card_prices",
+	key:     []string{"card_id", "price_date"},
+	columns: []string{"card_id", "price_date", "usd", "usd_foil", "usd_etched", "eur", "eur_foil", "tix"},
+}
+
+// FromPricesJson maps the prices of a card on priceDate. Only the date part of
+// priceDate, in UTC, is kept.
+func FromPricesJson(cardID string, priceDate time.Time, prices *objects.Prices) *CardPrice {
+	return &CardPrice{
+		CardID:    cardID,
+		PriceDate: priceDate.UTC().Truncate(24 * time.Hour),
+		Usd:       prices.Usd,
+		UsdFoil:   prices.UsdFoil,
+		UsdEtched: prices.UsdEtched,
+		Eur:       prices.Eur,
+		EurFoil:   prices.EurFoil,
+		Tix:       prices.Tix,
+	}
+}
+
+// HasPrice reports whether the card has a price in any currency or finish.
+func (p *CardPrice) HasPrice() bool {
+	return p.Usd.Valid || p.UsdFoil.Valid || p.UsdEtched.Valid || p.Eur.Valid || p.EurFoil.Valid || p.Tix.Valid
+}
+
+func (p *CardPrice) copyValues() []interface{} {
+	return []interface{}{p.CardID, p.PriceDate, nullDecimal(p.Usd), nullDecimal(p.UsdFoil),
+		nullDecimal(p.UsdEtched), nullDecimal(p.Eur), nullDecimal(p.EurFoil), nullDecimal(p.Tix)}
+}
+
+// nullDecimal converts d to a value pgx can encode as NUMERIC without losing
+// precision.
+func nullDecimal(d decimal.NullDecimal) interface{} {
+	if !d.Valid {
+		return nil
+	}
+
+	return d.Decimal.String()
+}
+
+// copyPrices upserts a batch of prices and returns how many were written. Prices
+// of cards that are not in the catalog, for example because they were filtered
+// out or soft deleted, are skipped.
+func copyPrices(ctx context.Context, conn *pgx.Conn, prices []*CardPrice) (int, error) {
+	rows := make([][]interface{}, 0, len(prices))
+
+	for _, p := range prices {
+		rows = append(rows, p.copyValues())
+	}
+
+	tx, err := conn.BeginEx(ctx, nil)
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(cardPricesCopyTable.createStagingQuery()); err != nil {
+		return 0, err
+	}
+
+	if _, err := tx.CopyFrom(pgx.Identifier{cardPricesCopyTable.staging()}, cardPricesCopyTable.columns, pgx.CopyFromRows(rows)); err != nil {
+		return 0, err
+	}
+
+	tag, err := tx.Exec(`
+	INSERT INTO card_prices (card_id, price_date, usd, usd_foil, usd_etched, eur, eur_foil, tix)
+	SELECT s.card_id, s.price_date, s.usd, s.usd_foil, s.usd_etched, s.eur, s.eur_foil, s.tix
+	FROM card_prices_staging s
+	JOIN cards c ON c.id = s.card_id AND c.deleted_at IS NULL
+	ON CONFLICT (card_id, price_date) DO UPDATE SET
+		usd = EXCLUDED.usd,
+		usd_foil = EXCLUDED.usd_foil,
+		usd_etched = EXCLUDED.usd_etched,
+		eur = EXCLUDED.eur,
+		eur_foil = EXCLUDED.eur_foil,
+		tix = EXCLUDED.tix`)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return int(tag.RowsAffected()), tx.CommitEx(ctx)
+}
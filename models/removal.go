@@ -0,0 +1,114 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	"github.com/jackc/pgx"
+)
+
+var ErrRemovalThresholdExceeded = errors.New("too many cards would be removed from the catalog")
+
+// removeMissingCards deletes, or marks as deleted, every live card whose id is not
+// in seen. Nothing is changed when the removed share of the catalog would exceed
+// maxPercent.
+func removeMissingCards(ctx context.Context, conn *pgx.Conn, seen []string, hard bool, maxPercent float64) ([]string, error) {
+	tx, err := conn.BeginEx(ctx, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	if err := copyIds(tx, "seen_cards", seen); err != nil {
+		return nil, err
+	}
+
+	var total int
+
+	if err := tx.QueryRow("SELECT count(*) FROM cards WHERE deleted_at IS NULL").Scan(&total); err != nil {
+		return nil, err
+	}
+
+	missingRows, err := tx.Query(`
+	SELECT c.id::text FROM cards c
+	WHERE c.deleted_at IS NULL AND NOT EXISTS (SELECT 1 FROM seen_cards s WHERE s.id = c.id)
+	`)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var missing []string
+
+	for missingRows.Next() {
+		var id string
+
+		if err := missingRows.Scan(&id); err != nil {
+			missingRows.Close()
+			return nil, err
+		}
+
+		missing = append(missing, id)
+	}
+
+	missingRows.Close()
+
+	if err := missingRows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(missing) == 0 {
+		return nil, tx.CommitEx(ctx)
+	}
+
+	if float64(len(missing))*100 > maxPercent*float64(total) {
+		slog.Error("Refusing to remove cards", "missing", len(missing), "catalog", total, "maxPercent", maxPercent)
+		return nil, ErrRemovalThresholdExceeded
+	}
+
+	var queries []string
+
+	if hard {
+		queries = []string{
+			`DELETE FROM image_uris
+			WHERE card_id = ANY($1::uuid[])
+				OR card_face_id IN (SELECT id FROM card_faces WHERE card_id = ANY($1::uuid[]))`,
+			`DELETE FROM card_faces WHERE card_id = ANY($1::uuid[])`,
+			`DELETE FROM card_legalities WHERE card_id = ANY($1::uuid[])`,
+			`DELETE FROM card_prices WHERE card_id = ANY($1::uuid[])`,
+			`DELETE FROM cards WHERE id = ANY($1::uuid[])`,
+		}
+	} else {
+		queries = []string{
+			`UPDATE cards SET deleted_at = now() WHERE id = ANY($1::uuid[])`,
+		}
+	}
+
+	for _, query := range queries {
+		if _, err := tx.Exec(query, missing); err != nil {
+			return nil, err
+		}
+	}
+
+	return missing, tx.CommitEx(ctx)
+}
+
+// copyIds streams ids into a temporary table dropped when tx commits.
+func copyIds(tx *pgx.Tx, table string, ids []string) error {
+	if _, err := tx.Exec("CREATE TEMPORARY TABLE " + table + " (id UUID) ON COMMIT DROP"); err != nil {
+		return err
+	}
+
+	rows := make([][]interface{}, 0, len(ids))
+
+	for _, id := range ids {
+		rows = append(rows, []interface{}{id})
+	}
+
+	_, err := tx.CopyFrom(pgx.Identifier{table}, []string{"id"}, pgx.CopyFromRows(rows))
+
+	return err
+}
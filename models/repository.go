@@ -0,0 +1,206 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx"
+	"github.com/jackc/pgx/stdlib"
+	"github.com/jmoiron/sqlx"
+)
+
+// repository is embedded by the repositories that work on a pgx connection of the
+// pool, for COPY and multi-statement transactions.
+type repository struct {
+	db         *sqlx.DB
+	maxRetries int
+}
+
+// withConn runs fn on a connection acquired from the pool, retrying it like a
+// transaction on serialization, deadlock and connection errors. fn begins its
+// transaction with ctx.
+func (r *repository) withConn(ctx context.Context, fn func(conn *pgx.Conn) error) error {
+	return withRetry(ctx, r.maxRetries, func() error {
+		conn, err := stdlib.AcquireConn(r.db.DB)
+
+		if err != nil {
+			return err
+		}
+
+		defer stdlib.ReleaseConn(r.db.DB, conn)
+
+		return fn(conn)
+	})
+}
+
+type CardRepository interface {
+	// Save writes the card, its image uris, faces and legalities in a single
+	// transaction, attributing legality changes to jobID.
+	Save(ctx context.Context, jobID string, card *Card) error
+	// SaveTx writes the card graph using a caller-managed transaction.
+	SaveTx(tx sqlx.Ext, jobID string, card *Card) error
+	// SaveAll writes a batch of card graphs with COPY and set-based upserts.
+	SaveAll(ctx context.Context, jobID string, cards []*Card) error
+	// RemoveMissing removes live cards whose ids were not seen in the bulk file and
+	// returns their ids. See removeMissingCards for the threshold semantics.
+	RemoveMissing(ctx context.Context, seen []string, hard bool, maxPercent float64) ([]string, error)
+	// TagBulkType records that exactly the cards with the given ids are part of
+	// the bulkType bulk file and returns how many of them are in the catalog.
+	TagBulkType(ctx context.Context, bulkType string, ids []string) (int, error)
+	// ContentHashes returns the stored content hash of every live card by id.
+	ContentHashes(ctx context.Context) (map[string]string, error)
+	// LatestReleaseDate returns the release date of the newest live card, or nil
+	// when there is none.
+	LatestReleaseDate(ctx context.Context) (*time.Time, error)
+}
+
+type cardRepository struct {
+	repository
+}
+
+func NewCardRepository(db *sqlx.DB, maxRetries int) CardRepository {
+	return &cardRepository{repository{db: db, maxRetries: maxRetries}}
+}
+
+func (r *cardRepository) Save(ctx context.Context, jobID string, card *Card) error {
+	return InTransaction(ctx, r.db, r.maxRetries, func(tx *sqlx.Tx) error {
+		return r.SaveTx(tx, jobID, card)
+	})
+}
+
+func (r *cardRepository) SaveTx(tx sqlx.Ext, jobID string, card *Card) error {
+	return card.Save(tx, jobID)
+}
+
+func (r *cardRepository) SaveAll(ctx context.Context, jobID string, cards []*Card) error {
+	return r.withConn(ctx, func(conn *pgx.Conn) error {
+		return copyCards(ctx, conn, jobID, cards)
+	})
+}
+
+func (r *cardRepository) RemoveMissing(ctx context.Context, seen []string, hard bool, maxPercent float64) ([]string, error) {
+	var removed []string
+
+	err := r.withConn(ctx, func(conn *pgx.Conn) (err error) {
+		removed, err = removeMissingCards(ctx, conn, seen, hard, maxPercent)
+
+		return err
+	})
+
+	return removed, err
+}
+
+func (r *cardRepository) ContentHashes(ctx context.Context) (map[string]string, error) {
+	return loadContentHashes(ctx, r.db)
+}
+
+func (r *cardRepository) LatestReleaseDate(ctx context.Context) (*time.Time, error) {
+	return latestReleaseDate(ctx, r.db)
+}
+
+func (r *cardRepository) TagBulkType(ctx context.Context, bulkType string, ids []string) (int, error) {
+	var tagged int
+
+	err := r.withConn(ctx, func(conn *pgx.Conn) (err error) {
+		tagged, err = tagBulkType(ctx, conn, bulkType, ids)
+
+		return err
+	})
+
+	return tagged, err
+}
+
+type RulingRepository interface {
+	// Replace makes the stored rulings match the given ones.
+	Replace(ctx context.Context, rulings []*Ruling) (RulingCounts, error)
+}
+
+type rulingRepository struct {
+	repository
+}
+
+func NewRulingRepository(db *sqlx.DB, maxRetries int) RulingRepository {
+	return &rulingRepository{repository{db: db, maxRetries: maxRetries}}
+}
+
+func (r *rulingRepository) Replace(ctx context.Context, rulings []*Ruling) (RulingCounts, error) {
+	var counts RulingCounts
+
+	err := r.withConn(ctx, func(conn *pgx.Conn) (err error) {
+		counts, err = replaceRulings(ctx, conn, rulings)
+
+		return err
+	})
+
+	return counts, err
+}
+
+type SetRepository interface {
+	// SaveAll upserts the given sets.
+	SaveAll(ctx context.Context, sets []*Set) error
+}
+
+type setRepository struct {
+	repository
+}
+
+func NewSetRepository(db *sqlx.DB, maxRetries int) SetRepository {
+	return &setRepository{repository{db: db, maxRetries: maxRetries}}
+}
+
+func (r *setRepository) SaveAll(ctx context.Context, sets []*Set) error {
+	return r.withConn(ctx, func(conn *pgx.Conn) error {
+		return copySets(ctx, conn, sets)
+	})
+}
+
+type PriceRepository interface {
+	// SaveAll upserts a batch of prices and returns how many were written.
+	SaveAll(ctx context.Context, prices []*CardPrice) (int, error)
+}
+
+type priceRepository struct {
+	repository
+}
+
+func NewPriceRepository(db *sqlx.DB, maxRetries int) PriceRepository {
+	return &priceRepository{repository{db: db, maxRetries: maxRetries}}
+}
+
+func (r *priceRepository) SaveAll(ctx context.Context, prices []*CardPrice) (int, error) {
+	var saved int
+
+	err := r.withConn(ctx, func(conn *pgx.Conn) (err error) {
+		saved, err = copyPrices(ctx, conn, prices)
+
+		return err
+	})
+
+	return saved, err
+}
+
+type TokenRepository interface {
+	// Replace makes the stored tokens and card links match the given ones and
+	// returns the ids of the tokens it deleted. See replaceTokens.
+	Replace(ctx context.Context, tokens []*Token, links []*CardToken, remove bool) ([]string, error)
+}
+
+type tokenRepository struct {
+	repository
+}
+
+func NewTokenRepository(db *sqlx.DB, maxRetries int) TokenRepository {
+	return &tokenRepository{repository{db: db, maxRetries: maxRetries}}
+}
+
+func (r *tokenRepository) Replace(ctx context.Context, tokens []*Token, links []*CardToken, remove bool) ([]string, error) {
+	var removed []string
+
+	err := r.withConn(ctx, func(conn *pgx.Conn) (err error) {
+		removed, err = replaceTokens(ctx, conn, tokens, links, remove)
+
+		return err
+	})
+
+	return removed, err
+}
@@ -0,0 +1,116 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx"
+	"spellscan.com/card-loader/objects"
+)
+
+// Ruling is identified by its whole content, so an edited ruling is stored as a
+// new row and the old one is removed.
+type Ruling struct {
+	ID          string    `db:"id"`
+	OracleID    string    `db:"oracle_id"`
+	Source      string    `db:"source"`
+	PublishedAt time.Time `db:"published_at"`
+	Comment     string    `db:"comment"`
+}
+
+var rulingsCopyTable = copyTable{
+	name:    "rulings",
+	columns: []string{"id", "oracle_id", "source", "published_at", "comment"},
+}
+
+func FromRulingJson(ruling *objects.Ruling) (*Ruling, error) {
+	publishedAt, err := time.Parse(time.DateOnly, ruling.PublishedAt)
+
+	if err != nil {
+		return nil, fmt.Errorf("ruling of %s has invalid published_at: %w", ruling.OracleID, err)
+	}
+
+	key := fmt.Sprintf("%s/rulings/%s/%s/%s", ruling.OracleID, ruling.Source, ruling.PublishedAt, ruling.Comment)
+
+	return &Ruling{
+		ID:          uuid.NewSHA1(identityNamespace, []byte(key)).String(),
+		OracleID:    ruling.OracleID,
+		Source:      ruling.Source,
+		PublishedAt: publishedAt,
+		Comment:     ruling.Comment,
+	}, nil
+}
+
+// RulingCounts describes a replacement of the rulings table.
+type RulingCounts struct {
+	// Rulings is how many distinct rulings were written, after dropping the ones
+	// the rulings file repeats verbatim.
+	Rulings  int
+	Inserted int
+	Removed  int
+}
+
+// Unchanged is how many of the written rulings were already stored.
+func (c RulingCounts) Unchanged() int {
+	return c.Rulings - c.Inserted
+}
+
+// replaceRulings makes the rulings table hold exactly the given rulings.
+func replaceRulings(ctx context.Context, conn *pgx.Conn, rulings []*Ruling) (RulingCounts, error) {
+	var counts RulingCounts
+
+	rows := make([][]interface{}, 0, len(rulings))
+
+	// The rulings file can repeat a ruling verbatim, which maps to the same id.
+	unique := make(map[string]bool, len(rulings))
+
+	for _, r := range rulings {
+		if unique[r.ID] {
+			continue
+		}
+
+		unique[r.ID] = true
+		rows = append(rows, []interface{}{r.ID, r.OracleID, r.Source, r.PublishedAt, r.Comment})
+	}
+
+	tx, err := conn.BeginEx(ctx, nil)
+
+	if err != nil {
+		return counts, err
+	}
+
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(rulingsCopyTable.createStagingQuery()); err != nil {
+		return counts, err
+	}
+
+	if _, err := tx.CopyFrom(pgx.Identifier{rulingsCopyTable.staging()}, rulingsCopyTable.columns, pgx.CopyFromRows(rows)); err != nil {
+		return counts, err
+	}
+
+	columns := strings.Join(rulingsCopyTable.columns, ", ")
+
+	inserted, err := tx.Exec(fmt.Sprintf("INSERT INTO rulings (%s) SELECT %s FROM rulings_staging ON CONFLICT (id) DO NOTHING", columns, columns))
+
+	if err != nil {
+		return counts, err
+	}
+
+	removed, err := tx.Exec(`DELETE FROM rulings WHERE id NOT IN (SELECT id FROM rulings_staging)`)
+
+	if err != nil {
+		return counts, err
+	}
+
+	counts = RulingCounts{
+		Rulings:  len(rows),
+		Inserted: int(inserted.RowsAffected()),
+		Removed:  int(removed.RowsAffected()),
+	}
+
+	return counts, tx.CommitEx(ctx)
+}
@@ -0,0 +1,6 @@
+package models
+
+// SchemaVersion is the version of the last migration in the migrations package
+// that the models depend on. Bump it together with the migration whenever a
+// model starts reading or writing a new table or column.
+const SchemaVersion = 17
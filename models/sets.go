@@ -0,0 +1,89 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/jackc/pgx"
+	"spellscan.com/card-loader/objects"
+)
+
+type Set struct {
+	ID            string         `db:"id"`
+	Code          string         `db:"code"`
+	Name          string         `db:"set_name"`
+	SetType       string         `db:"set_type"`
+	ReleasedAt    sql.NullTime   `db:"released_at"`
+	CardCount     int            `db:"card_count"`
+	ParentSetCode sql.NullString `db:"parent_set_code"`
+	IconSvgURI    string         `db:"icon_svg_uri"`
+	Digital       bool           `db:"digital"`
+}
+
+var setsCopyTable = copyTable{
+	name: "sets",
+	columns: []string{"id", "code", "set_name", "set_type", "released_at",
+		"card_count", "parent_set_code", "icon_svg_uri", "digital"},
+}
+
+func FromSetJson(set *objects.Set) *Set {
+	s := &Set{
+		ID:            set.ID,
+		Code:          set.Code,
+		Name:          set.Name,
+		SetType:       set.SetType,
+		CardCount:     set.CardCount,
+		ParentSetCode: sql.NullString{String: set.ParentSetCode, Valid: set.ParentSetCode != ""},
+		IconSvgURI:    set.IconSvgURI,
+		Digital:       set.Digital,
+	}
+
+	// Announced sets may not have a release date yet.
+	if releasedAt, err := time.Parse(time.DateOnly, set.ReleasedAt); err == nil {
+		s.ReleasedAt = sql.NullTime{Time: releasedAt, Valid: true}
+	}
+
+	return s
+}
+
+func (s *Set) copyValues() []interface{} {
+	var releasedAt interface{}
+
+	if s.ReleasedAt.Valid {
+		releasedAt = s.ReleasedAt.Time
+	}
+
+	return []interface{}{s.ID, s.Code, s.Name, s.SetType, releasedAt,
+		s.CardCount, nullString(s.ParentSetCode), s.IconSvgURI, s.Digital}
+}
+
+func copySets(ctx context.Context, conn *pgx.Conn, sets []*Set) error {
+	rows := make([][]interface{}, 0, len(sets))
+
+	for _, s := range sets {
+		rows = append(rows, s.copyValues())
+	}
+
+	tx, err := conn.BeginEx(ctx, nil)
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(setsCopyTable.createStagingQuery()); err != nil {
+		return err
+	}
+
+	if _, err := tx.CopyFrom(pgx.Identifier{setsCopyTable.staging()}, setsCopyTable.columns, pgx.CopyFromRows(rows)); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(setsCopyTable.mergeQuery()); err != nil {
+		return err
+	}
+
+	return tx.CommitEx(ctx)
+}
@@ -0,0 +1,247 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx"
+	"github.com/lib/pq"
+	"spellscan.com/card-loader/objects"
+)
+
+// Token is a token, emblem or art series card. Tokens are kept apart from the
+// cards catalog, so that searching for a card never returns one.
+type Token struct {
+	ID              string         `db:"id"`
+	OracleID        sql.NullString `db:"oracle_id"`
+	Name            string         `db:"card_name"`
+	Lang            string         `db:"lang"`
+	ReleasedAt      string         `db:"released_at"`
+	Layout          string         `db:"layout"`
+	ManaCost        string         `db:"mana_cost"`
+	TypeLine        string         `db:"type_line"`
+	PrintedText     string         `db:"printed_text"`
+	Colors          pq.StringArray `db:"colors"`
+	Power           sql.NullString `db:"power"`
+	Toughness       sql.NullString `db:"toughness"`
+	Set             string         `db:"card_set"`
+	CollectorNumber string         `db:"collector_number"`
+	Artist          string         `db:"artist"`
+	IllustrationID  sql.NullString `db:"illustration_id"`
+	ImageUris       *ImageUris     `db:"-"`
+	CardFaces       []*CardFace    `db:"-"`
+}
+
+// CardToken links a card to a token it creates, as listed in all_parts. The card
+// may be a printing that is not in the catalog.
+type CardToken struct {
+	CardID  string `db:"card_id"`
+	TokenID string `db:"token_id"`
+}
+
+var tokensCopyTable = copyTable{
+	name: "tokens",
+	columns: []string{"id", "oracle_id", "card_name", "lang", "released_at", "layout", "mana_cost",
+		"type_line", "printed_text", "colors", "power", "toughness", "card_set", "collector_number",
+		"artist", "illustration_id"},
+}
+
+// tokenFacesCopyTable and tokenImageUrisCopyTable take the same rows as their
+// card counterparts, with the owner stored in token_id and token_face_id.
+var tokenFacesCopyTable = copyTable{
+	name:  "token_faces",
+	owner: "token_id",
+	columns: []string{"id", "token_id", "card_name", "mana_cost", "type_line",
+		"printed_text", "flavor_text", "colors", "color_indicator",
+		"power", "toughness", "loyalty", "artist", "illustration_id"},
+}
+
+var tokenImageUrisCopyTable = copyTable{
+	name:  "token_image_uris",
+	owner: "token_id",
+	face:  "token_face_id",
+	columns: []string{"id", "token_id", "token_face_id", "small_uri", "normal_uri",
+		"large_uri", "png_uri", "art_crop_uri", "border_crop_uri"},
+}
+
+var tokenGraphTables = graphTables{owners: tokensCopyTable, faces: tokenFacesCopyTable, images: tokenImageUrisCopyTable}
+
+var cardTokensCopyTable = copyTable{
+	name:    "card_tokens",
+	key:     []string{"card_id", "token_id"},
+	columns: []string{"card_id", "token_id"},
+}
+
+func FromTokenJson(card *objects.Card) *Token {
+	token := &Token{
+		ID:              card.ID,
+		OracleID:        optionalString(card.OracleID),
+		Name:            card.Name,
+		Lang:            card.Lang,
+		ReleasedAt:      card.ReleasedAt,
+		Layout:          card.Layout,
+		ManaCost:        card.ManaCost,
+		TypeLine:        card.TypeLine,
+		PrintedText:     card.OracleText,
+		Colors:          card.Colors,
+		Power:           optionalString(card.Power),
+		Toughness:       optionalString(card.Toughness),
+		Set:             card.Set,
+		CollectorNumber: card.CollectorNumber,
+		Artist:          card.Artist,
+		IllustrationID:  optionalString(card.IllustrationID),
+		ImageUris:       fromImageUrisJson(card.ID, &card.ImageUris, cardObject),
+		CardFaces:       fromCardFacesJson(card.ID, card.CardFaces),
+	}
+
+	if card.PrintedName != "" {
+		token.Name = card.PrintedName
+	}
+
+	if card.PrintedText != "" {
+		token.PrintedText = card.PrintedText
+	}
+
+	return token
+}
+
+// CardTokensFromJson returns the token links found in the all_parts of card. A
+// card lists the tokens it creates and a token lists the cards that create it,
+// so both sides are read and duplicates are dropped when saving.
+func CardTokensFromJson(card *objects.Card, isToken bool) []*CardToken {
+	var links []*CardToken
+
+	for _, part := range card.AllParts {
+		if part.ID == card.ID {
+			continue
+		}
+
+		switch {
+		case isToken && part.Component == objects.ComponentComboPiece:
+			links = append(links, &CardToken{CardID: part.ID, TokenID: card.ID})
+		case !isToken && part.Component == objects.ComponentToken:
+			links = append(links, &CardToken{CardID: card.ID, TokenID: part.ID})
+		}
+	}
+
+	return links
+}
+
+func (t *Token) copyValues() ([]interface{}, error) {
+	releasedAt, err := time.Parse(time.DateOnly, t.ReleasedAt)
+
+	if err != nil {
+		return nil, fmt.Errorf("token %s has invalid released_at: %w", t.ID, err)
+	}
+
+	return []interface{}{t.ID, nullString(t.OracleID), t.Name, t.Lang, releasedAt, t.Layout, t.ManaCost,
+		t.TypeLine, t.PrintedText, []string(t.Colors), nullString(t.Power), nullString(t.Toughness), t.Set,
+		t.CollectorNumber, t.Artist, nullString(t.IllustrationID)}, nil
+}
+
+// replaceTokens makes the stored tokens and links match the given ones. Tokens
+// that are no longer present are deleted only when remove is set. It returns the
+// ids of the deleted tokens.
+func replaceTokens(ctx context.Context, conn *pgx.Conn, tokens []*Token, links []*CardToken, remove bool) ([]string, error) {
+	var rows graphRows
+
+	var linkRows [][]interface{}
+
+	for _, t := range tokens {
+		row, err := t.copyValues()
+
+		if err != nil {
+			return nil, err
+		}
+
+		rows.add(row, t.ImageUris, t.CardFaces)
+	}
+
+	unique := make(map[CardToken]bool, len(links))
+
+	for _, l := range links {
+		if unique[*l] {
+			continue
+		}
+
+		unique[*l] = true
+		linkRows = append(linkRows, []interface{}{l.CardID, l.TokenID})
+	}
+
+	tx, err := conn.BeginEx(ctx, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	if err := tokenGraphTables.merge(tx, rows); err != nil {
+		return nil, err
+	}
+
+	var removed []string
+
+	// The merge keeps tokens missing from the batch, so they are still found here.
+	if remove {
+		missing, err := tx.Query(`SELECT id::text FROM tokens WHERE id NOT IN (SELECT id FROM tokens_staging)`)
+
+		if err != nil {
+			return nil, err
+		}
+
+		for missing.Next() {
+			var id string
+
+			if err := missing.Scan(&id); err != nil {
+				missing.Close()
+				return nil, err
+			}
+
+			removed = append(removed, id)
+		}
+
+		missing.Close()
+
+		if err := missing.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := tx.Exec(cardTokensCopyTable.createStagingQuery()); err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.CopyFrom(pgx.Identifier{cardTokensCopyTable.staging()}, cardTokensCopyTable.columns, pgx.CopyFromRows(linkRows)); err != nil {
+		return nil, err
+	}
+
+	queries := []string{
+		`DELETE FROM card_tokens WHERE (card_id, token_id) NOT IN (SELECT card_id, token_id FROM card_tokens_staging)`,
+		`INSERT INTO card_tokens (card_id, token_id) SELECT card_id, token_id FROM card_tokens_staging ON CONFLICT DO NOTHING`,
+	}
+
+	for _, query := range queries {
+		if _, err := tx.Exec(query); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(removed) != 0 {
+		for _, query := range []string{
+			`DELETE FROM token_image_uris
+			WHERE token_id = ANY($1::uuid[])
+				OR token_face_id IN (SELECT id FROM token_faces WHERE token_id = ANY($1::uuid[]))`,
+			`DELETE FROM token_faces WHERE token_id = ANY($1::uuid[])`,
+			`DELETE FROM tokens WHERE id = ANY($1::uuid[])`,
+		} {
+			if _, err := tx.Exec(query, removed); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return removed, tx.CommitEx(ctx)
+}
@@ -0,0 +1,80 @@
+package models
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx"
+	"github.com/jmoiron/sqlx"
+)
+
+const retryBackoff = 100 * time.Millisecond
+
+// InTransaction runs fn inside a transaction, rolling it back when fn fails and
+// retrying the whole transaction up to maxRetries times on serialization,
+// deadlock and connection errors. Cancelling ctx rolls the transaction back and
+// stops the retries.
+func InTransaction(ctx context.Context, db *sqlx.DB, maxRetries int, fn func(tx *sqlx.Tx) error) error {
+	return withRetry(ctx, maxRetries, func() error {
+		return runTransaction(ctx, db, fn)
+	})
+}
+
+func withRetry(ctx context.Context, maxRetries int, fn func() error) error {
+	var err error
+
+	for attempt := 0; attempt <= maxRetries; attempt++ {
+		if attempt > 0 {
+			slog.Warn("Retrying transaction", "attempt", attempt, "err", err)
+
+			backoff := time.NewTimer(retryBackoff * time.Duration(1<<(attempt-1)))
+
+			select {
+			case <-backoff.C:
+			case <-ctx.Done():
+				backoff.Stop()
+				return ctx.Err()
+			}
+		}
+
+		err = fn()
+
+		if err == nil || !isRetryable(err) {
+			return err
+		}
+	}
+
+	return err
+}
+
+func runTransaction(ctx context.Context, db *sqlx.DB, fn func(tx *sqlx.Tx) error) error {
+	tx, err := db.BeginTxx(ctx, nil)
+
+	if err != nil {
+		return err
+	}
+
+	if err := fn(tx); err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil {
+			slog.Warn("Could not rollback transaction", "err", rbErr)
+		}
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func isRetryable(err error) bool {
+	var pgErr pgx.PgError
+
+	if errors.As(err, &pgErr) {
+		// serialization_failure, deadlock_detected and the connection exception class
+		return pgErr.Code == "40001" || pgErr.Code == "40P01" || strings.HasPrefix(pgErr.Code, "08")
+	}
+
+	return errors.Is(err, driver.ErrBadConn) || errors.Is(err, pgx.ErrDeadConn)
+}
@@ -1,8 +1,45 @@
 package objects
 
 type CardSearch struct {
-	ID   string `json:"id"`
-	Name string `json:"name"`
-	Text string `json:"text"`
-	Set  string `json:"set"`
+	ID              string           `json:"id"`
+	Name            string           `json:"name"`
+	Text            string           `json:"text"`
+	OracleName      string           `json:"oracle_name"`
+	PrintedName     string           `json:"printed_name,omitempty"`
+	OracleText      string           `json:"oracle_text"`
+	PrintedText     string           `json:"printed_text,omitempty"`
+	Set             string           `json:"set"`
+	TypeLine        string           `json:"type_line"`
+	Supertypes      []string         `json:"supertypes"`
+	CardTypes       []string         `json:"card_types"`
+	Subtypes        []string         `json:"subtypes"`
+	PrintedSubtypes []string         `json:"printed_subtypes,omitempty"`
+	ManaSymbols     []string         `json:"mana_symbols"`
+	ManaKinds       []string         `json:"mana_kinds"`
+	Colors          []string         `json:"colors"`
+	ColorIdentity   []string         `json:"color_identity"`
+	CMC             float64          `json:"cmc"`
+	Rarity          string           `json:"rarity"`
+	Lang            string           `json:"lang"`
+	Layout          string           `json:"layout"`
+	CollectorNumber string           `json:"collector_number"`
+	Artist          string           `json:"artist"`
+	Keywords        []string         `json:"keywords"`
+	Legalities      Legalities       `json:"legalities"`
+	LegalFormats    []string         `json:"legal_formats"`
+	Thumbnail       string           `json:"thumbnail_uri"`
+	CreatedBy       []string         `json:"created_by,omitempty"`
+	Faces           []CardFaceSearch `json:"faces,omitempty"`
+}
+
+type CardFaceSearch struct {
+	Name        string   `json:"name"`
+	PrintedName string   `json:"printed_name,omitempty"`
+	OracleText  string   `json:"oracle_text"`
+	PrintedText string   `json:"printed_text,omitempty"`
+	ManaCost    string   `json:"mana_cost"`
+	TypeLine    string   `json:"type_line"`
+	Colors      []string `json:"colors"`
+	Artist      string   `json:"artist"`
+	Thumbnail   string   `json:"thumbnail_uri"`
 }
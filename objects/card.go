@@ -1,5 +1,7 @@
 package objects
 
+import "github.com/shopspring/decimal"
+
 type ImageUris struct {
 	Small      string `json:"small"`
 	Normal     string `json:"normal"`
@@ -10,54 +12,39 @@ type ImageUris struct {
 }
 
 type CardFace struct {
-	Object         string    `json:"object"`
-	Name           string    `json:"name"`
-	ManaCost       string    `json:"mana_cost"`
-	TypeLine       string    `json:"type_line"`
-	OracleText     string    `json:"oracle_text"`
-	FlavorText     string    `json:"flavor_text"`
-	Colors         []string  `json:"colors"`
-	ColorIndicator []string  `json:"color_indicator"`
-	Power          string    `json:"power"`
-	Toughness      string    `json:"toughness"`
-	Artist         string    `json:"artist"`
-	ArtistID       string    `json:"artist_id"`
-	IllustrationID string    `json:"illustration_id"`
-	ImageUris      ImageUris `json:"image_uris"`
+	Object          string    `json:"object"`
+	Name            string    `json:"name"`
+	PrintedName     string    `json:"printed_name"`
+	ManaCost        string    `json:"mana_cost"`
+	TypeLine        string    `json:"type_line"`
+	PrintedTypeLine string    `json:"printed_type_line"`
+	OracleText      string    `json:"oracle_text"`
+	PrintedText     string    `json:"printed_text"`
+	FlavorText      string    `json:"flavor_text"`
+	Colors          []string  `json:"colors"`
+	ColorIndicator  []string  `json:"color_indicator"`
+	Power           string    `json:"power"`
+	Toughness       string    `json:"toughness"`
+	Loyalty         string    `json:"loyalty"`
+	Artist          string    `json:"artist"`
+	ArtistID        string    `json:"artist_id"`
+	IllustrationID  string    `json:"illustration_id"`
+	ImageUris       ImageUris `json:"image_uris"`
 }
 
-type Legalities struct {
-	Standard        string `json:"standard"`
-	Future          string `json:"future"`
-	Historic        string `json:"historic"`
-	Timeless        string `json:"timeless"`
-	Gladiator       string `json:"gladiator"`
-	Pioneer         string `json:"pioneer"`
-	Explorer        string `json:"explorer"`
-	Modern          string `json:"modern"`
-	Legacy          string `json:"legacy"`
-	Pauper          string `json:"pauper"`
-	Vintage         string `json:"vintage"`
-	Penny           string `json:"penny"`
-	Commander       string `json:"commander"`
-	Oathbreaker     string `json:"oathbreaker"`
-	Brawl           string `json:"brawl"`
-	HistoricBrawl   string `json:"historicbrawl"`
-	Alchemy         string `json:"alchemy"`
-	PauperCommander string `json:"paupercommander"`
-	Duel            string `json:"duel"`
-	Oldschool       string `json:"oldschool"`
-	Premodern       string `json:"premodern"`
-	Predh           string `json:"predh"`
-}
+// Legalities maps a format, such as "pioneer", to the card's status in it:
+// legal, not_legal, restricted or banned.
+type Legalities map[string]string
 
+// Prices holds the daily prices of a card. Scryfall sends them as strings, or
+// null when a card has no price in that currency or finish.
 type Prices struct {
-	Usd       interface{} `json:"usd"`
-	UsdFoil   interface{} `json:"usd_foil"`
-	UsdEtched interface{} `json:"usd_etched"`
-	Eur       interface{} `json:"eur"`
-	EurFoil   interface{} `json:"eur_foil"`
-	Tix       interface{} `json:"tix"`
+	Usd       decimal.NullDecimal `json:"usd"`
+	UsdFoil   decimal.NullDecimal `json:"usd_foil"`
+	UsdEtched decimal.NullDecimal `json:"usd_etched"`
+	Eur       decimal.NullDecimal `json:"eur"`
+	EurFoil   decimal.NullDecimal `json:"eur_foil"`
+	Tix       decimal.NullDecimal `json:"tix"`
 }
 
 type RelatedUris struct {
@@ -73,67 +60,92 @@ type PurchaseUris struct {
 	Cardhoarder string `json:"cardhoarder"`
 }
 
+const (
+	ComponentToken      = "token"
+	ComponentMeldPart   = "meld_part"
+	ComponentMeldResult = "meld_result"
+	ComponentComboPiece = "combo_piece"
+)
+
+// RelatedCard is an entry of all_parts, linking a card to the tokens it creates,
+// the cards that create it or the other parts of a meld.
+type RelatedCard struct {
+	Object    string `json:"object"`
+	ID        string `json:"id"`
+	Component string `json:"component"`
+	Name      string `json:"name"`
+	TypeLine  string `json:"type_line"`
+	URI       string `json:"uri"`
+}
+
 type Card struct {
-	Object          string       `json:"object"`
-	ID              string       `json:"id"`
-	OracleID        string       `json:"oracle_id"`
-	MultiverseIDs   []int        `json:"multiverse_ids"`
-	Name            string       `json:"name"`
-	PrintedName     string       `json:"printed_name"`
-	Lang            string       `json:"lang"`
-	ReleasedAt      string       `json:"released_at"`
-	Uri             string       `json:"uri"`
-	ScryfallUri     string       `json:"scryfall_uri"`
-	Layout          string       `json:"layout"`
-	HighresImage    bool         `json:"highres_image"`
-	ImageStatus     string       `json:"image_status"`
-	ImageUris       ImageUris    `json:"image_uris"`
-	CardFaces       []CardFace   `json:"card_faces"`
-	ManaCost        string       `json:"mana_cost"`
-	CMC             float64      `json:"cmc"`
-	TypeLine        string       `json:"type_line"`
-	PrintedTypeLine string       `json:"printed_type_line"`
-	OracleText      string       `json:"oracle_text"`
-	PrintedText     string       `json:"printed_text"`
-	Colors          []string     `json:"colors"`
-	ColorIdentity   []string     `json:"color_identity"`
-	Keywords        []string     `json:"keywords"`
-	Legalities      Legalities   `json:"legalities"`
-	Games           []string     `json:"games"`
-	Reserved        bool         `json:"reserved"`
-	Foil            bool         `json:"foil"`
-	Nonfoil         bool         `json:"nonfoil"`
-	Finishes        []string     `json:"finishes"`
-	Oversized       bool         `json:"oversized"`
-	Promo           bool         `json:"promo"`
-	Reprint         bool         `json:"reprint"`
-	Variation       bool         `json:"variation"`
-	SetID           string       `json:"set_id"`
-	Set             string       `json:"set"`
-	SetName         string       `json:"set_name"`
-	SetType         string       `json:"set_type"`
-	SetURI          string       `json:"set_uri"`
-	SetSearchURI    string       `json:"set_search_uri"`
-	ScryfallSetURI  string       `json:"scryfall_set_uri"`
-	RulingsURI      string       `json:"rulings_uri"`
-	PrintsSearchURI string       `json:"prints_search_uri"`
-	CollectorNumber string       `json:"collector_number"`
-	Digital         bool         `json:"digital"`
-	Rarity          string       `json:"rarity"`
-	FlavorText      string       `json:"flavor_text"`
-	CardBackID      string       `json:"card_back_id"`
-	Artist          string       `json:"artist"`
-	ArtistIDs       []string     `json:"artist_ids"`
-	IllustrationID  string       `json:"illustration_id"`
-	BorderColor     string       `json:"border_color"`
-	Frame           string       `json:"frame"`
-	FullArt         bool         `json:"full_art"`
-	Textless        bool         `json:"textless"`
-	Booster         bool         `json:"booster"`
-	StorySpotlight  bool         `json:"story_spotlight"`
-	EdhrecRank      int          `json:"edhrec_rank"`
-	PennyRank       int          `json:"penny_rank"`
-	Prices          Prices       `json:"prices"`
-	RelatedUris     RelatedUris  `json:"related_uris"`
-	PurchaseUris    PurchaseUris `json:"purchase_uris"`
+	Object          string        `json:"object"`
+	ID              string        `json:"id"`
+	OracleID        string        `json:"oracle_id"`
+	MultiverseIDs   []int         `json:"multiverse_ids"`
+	Name            string        `json:"name"`
+	PrintedName     string        `json:"printed_name"`
+	Lang            string        `json:"lang"`
+	ReleasedAt      string        `json:"released_at"`
+	Uri             string        `json:"uri"`
+	ScryfallUri     string        `json:"scryfall_uri"`
+	Layout          string        `json:"layout"`
+	HighresImage    bool          `json:"highres_image"`
+	ImageStatus     string        `json:"image_status"`
+	ImageUris       ImageUris     `json:"image_uris"`
+	CardFaces       []CardFace    `json:"card_faces"`
+	AllParts        []RelatedCard `json:"all_parts"`
+	ManaCost        string        `json:"mana_cost"`
+	CMC             float64       `json:"cmc"`
+	Power           string        `json:"power"`
+	Toughness       string        `json:"toughness"`
+	Loyalty         string        `json:"loyalty"`
+	TypeLine        string        `json:"type_line"`
+	PrintedTypeLine string        `json:"printed_type_line"`
+	OracleText      string        `json:"oracle_text"`
+	PrintedText     string        `json:"printed_text"`
+	Colors          []string      `json:"colors"`
+	ColorIdentity   []string      `json:"color_identity"`
+	Keywords        []string      `json:"keywords"`
+	ProducedMana    []string      `json:"produced_mana"`
+	Legalities      Legalities    `json:"legalities"`
+	Games           []string      `json:"games"`
+	Reserved        bool          `json:"reserved"`
+	Foil            bool          `json:"foil"`
+	Nonfoil         bool          `json:"nonfoil"`
+	Finishes        []string      `json:"finishes"`
+	Oversized       bool          `json:"oversized"`
+	Promo           bool          `json:"promo"`
+	PromoTypes      []string      `json:"promo_types"`
+	Reprint         bool          `json:"reprint"`
+	Variation       bool          `json:"variation"`
+	SetID           string        `json:"set_id"`
+	Set             string        `json:"set"`
+	SetName         string        `json:"set_name"`
+	SetType         string        `json:"set_type"`
+	SetURI          string        `json:"set_uri"`
+	SetSearchURI    string        `json:"set_search_uri"`
+	ScryfallSetURI  string        `json:"scryfall_set_uri"`
+	RulingsURI      string        `json:"rulings_uri"`
+	PrintsSearchURI string        `json:"prints_search_uri"`
+	CollectorNumber string        `json:"collector_number"`
+	Digital         bool          `json:"digital"`
+	Rarity          string        `json:"rarity"`
+	FlavorText      string        `json:"flavor_text"`
+	CardBackID      string        `json:"card_back_id"`
+	Artist          string        `json:"artist"`
+	ArtistIDs       []string      `json:"artist_ids"`
+	IllustrationID  string        `json:"illustration_id"`
+	BorderColor     string        `json:"border_color"`
+	SecurityStamp   string        `json:"security_stamp"`
+	Frame           string        `json:"frame"`
+	FullArt         bool          `json:"full_art"`
+	Textless        bool          `json:"textless"`
+	Booster         bool          `json:"booster"`
+	StorySpotlight  bool          `json:"story_spotlight"`
+	EdhrecRank      int           `json:"edhrec_rank"`
+	PennyRank       int           `json:"penny_rank"`
+	Prices          Prices        `json:"prices"`
+	RelatedUris     RelatedUris   `json:"related_uris"`
+	PurchaseUris    PurchaseUris  `json:"purchase_uris"`
 }
@@ -0,0 +1,9 @@
+package objects
+
+type Ruling struct {
+	Object      string `json:"object"`
+	OracleID    string `json:"oracle_id"`
+	Source      string `json:"source"`
+	PublishedAt string `json:"published_at"`
+	Comment     string `json:"comment"`
+}
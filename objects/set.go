@@ -0,0 +1,21 @@
+package objects
+
+type SetList struct {
+	Object   string `json:"object"`
+	HasMore  bool   `json:"has_more"`
+	NextPage string `json:"next_page"`
+	Data     []Set  `json:"data"`
+}
+
+type Set struct {
+	Object        string `json:"object"`
+	ID            string `json:"id"`
+	Code          string `json:"code"`
+	Name          string `json:"name"`
+	SetType       string `json:"set_type"`
+	ReleasedAt    string `json:"released_at"`
+	CardCount     int    `json:"card_count"`
+	ParentSetCode string `json:"parent_set_code"`
+	Digital       bool   `json:"digital"`
+	IconSvgURI    string `json:"icon_svg_uri"`
+}
@@ -0,0 +1,47 @@
+package parsing
+
+import (
+	"errors"
+	"strings"
+
+	"spellscan.com/card-loader/objects"
+)
+
+type Card struct {
+	ManaCost        *ManaCost
+	TypeLine        *TypeLine
+	PrintedSubtypes []string
+}
+
+// ParseCard parses the mana cost and type lines of a card. Multi-faced cards that
+// only carry them on their faces are parsed from the faces. On error the parts
+// that could be parsed are still returned.
+func ParseCard(card *objects.Card) (*Card, error) {
+	manaCost, manaErr := ParseManaCost(cardOrFaces(card.ManaCost, card, func(f objects.CardFace) string { return f.ManaCost }))
+
+	typeLine, typeErr := ParseTypeLine(cardOrFaces(card.TypeLine, card, func(f objects.CardFace) string { return f.TypeLine }))
+
+	printedTypeLine := cardOrFaces(card.PrintedTypeLine, card, func(f objects.CardFace) string { return f.PrintedTypeLine })
+
+	return &Card{
+		ManaCost:        manaCost,
+		TypeLine:        typeLine,
+		PrintedSubtypes: ParsePrintedSubtypes(printedTypeLine),
+	}, errors.Join(manaErr, typeErr)
+}
+
+func cardOrFaces(value string, card *objects.Card, field func(objects.CardFace) string) string {
+	if value != "" {
+		return value
+	}
+
+	var values []string
+
+	for _, face := range card.CardFaces {
+		if v := field(face); v != "" {
+			values = append(values, v)
+		}
+	}
+
+	return strings.Join(values, " // ")
+}
@@ -0,0 +1,97 @@
+package parsing
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"spellscan.com/card-loader/objects"
+)
+
+func TestParseCard(t *testing.T) {
+	tests := []struct {
+		name            string
+		card            *objects.Card
+		symbols         []string
+		types           []string
+		subtypes        []string
+		printedSubtypes []string
+	}{
+		{
+			name:            "single faced",
+			card:            &objects.Card{ManaCost: "{1}{G}", TypeLine: "Creature — Bear", PrintedTypeLine: "Criatura — Urso"},
+			symbols:         []string{"1", "G"},
+			types:           []string{"Creature"},
+			subtypes:        []string{"Bear"},
+			printedSubtypes: []string{"Urso"},
+		},
+		{
+			name:     "split with card level cost",
+			card:     &objects.Card{ManaCost: "{1}{R} // {2}{G}", TypeLine: "Instant // Sorcery"},
+			symbols:  []string{"1", "R", "2", "G"},
+			types:    []string{"Instant", "Sorcery"},
+			subtypes: nil,
+		},
+		{
+			name: "faces only",
+			card: &objects.Card{CardFaces: []objects.CardFace{
+				{ManaCost: "{U}", TypeLine: "Creature — Human Wizard", PrintedTypeLine: "Criatura — Humano Mago"},
+				{TypeLine: "Creature — Human Insect", PrintedTypeLine: "Criatura — Humano Inseto"},
+			}},
+			symbols:         []string{"U"},
+			types:           []string{"Creature"},
+			subtypes:        []string{"Human", "Wizard", "Insect"},
+			printedSubtypes: []string{"Humano", "Mago", "Inseto"},
+		},
+		{
+			name: "card level values win over faces",
+			card: &objects.Card{ManaCost: "{W}", TypeLine: "Instant", CardFaces: []objects.CardFace{
+				{ManaCost: "{B}", TypeLine: "Sorcery"},
+			}},
+			symbols: []string{"W"},
+			types:   []string{"Instant"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parsed, err := ParseCard(tt.card)
+
+			if err != nil {
+				t.Fatalf("ParseCard() error = %v", err)
+			}
+
+			if got := parsed.ManaCost.SymbolNames(); !slices.Equal(got, tt.symbols) {
+				t.Errorf("mana symbols = %v, want %v", got, tt.symbols)
+			}
+
+			if !slices.Equal(parsed.TypeLine.Types, tt.types) {
+				t.Errorf("types = %v, want %v", parsed.TypeLine.Types, tt.types)
+			}
+
+			if !slices.Equal(parsed.TypeLine.Subtypes, tt.subtypes) {
+				t.Errorf("subtypes = %v, want %v", parsed.TypeLine.Subtypes, tt.subtypes)
+			}
+
+			if !slices.Equal(parsed.PrintedSubtypes, tt.printedSubtypes) {
+				t.Errorf("printed subtypes = %v, want %v", parsed.PrintedSubtypes, tt.printedSubtypes)
+			}
+		})
+	}
+}
+
+func TestParseCardJoinsErrors(t *testing.T) {
+	parsed, err := ParseCard(&objects.Card{ManaCost: "{1}{Q}", TypeLine: "Creature Widget — Bear"})
+
+	if !errors.Is(err, ErrInvalidManaCost) || !errors.Is(err, ErrInvalidTypeLine) {
+		t.Fatalf("ParseCard() error = %v, want both %v and %v", err, ErrInvalidManaCost, ErrInvalidTypeLine)
+	}
+
+	if got := parsed.ManaCost.SymbolNames(); !slices.Equal(got, []string{"1"}) {
+		t.Errorf("mana symbols = %v, want [1]", got)
+	}
+
+	if !slices.Equal(parsed.TypeLine.Types, []string{"Creature"}) || !slices.Equal(parsed.TypeLine.Subtypes, []string{"Bear"}) {
+		t.Errorf("type line = %+v, want the Creature type and the Bear subtype", parsed.TypeLine)
+	}
+}
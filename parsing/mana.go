@@ -0,0 +1,155 @@
+package parsing
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalidManaCost = errors.New("invalid mana cost")
+
+type SymbolKind string
+
+const (
+	KindGeneric   SymbolKind = "generic"
+	KindColored   SymbolKind = "colored"
+	KindColorless SymbolKind = "colorless"
+	KindHybrid    SymbolKind = "hybrid"
+	KindPhyrexian SymbolKind = "phyrexian"
+	KindSnow      SymbolKind = "snow"
+	KindVariable  SymbolKind = "x"
+)
+
+var manaColors = []string{"W", "U", "B", "R", "G"}
+
+// ManaSymbol is a single symbol of a mana cost, such as {2}, {W/U} or {G/P}.
+// Hybrid phyrexian symbols like {W/U/P} have both the hybrid and phyrexian kinds,
+// and every symbol that can be paid with a color, such as {2/W}, is colored.
+type ManaSymbol struct {
+	Symbol  string
+	Kinds   []SymbolKind
+	Colors  []string
+	Generic int
+}
+
+type ManaCost struct {
+	Symbols []ManaSymbol
+}
+
+// ParseManaCost parses a Scryfall mana cost, including the " // " separated
+// costs of multi-faced cards. An empty cost parses to no symbols.
+func ParseManaCost(cost string) (*ManaCost, error) {
+	manaCost := &ManaCost{}
+
+	for _, half := range strings.Split(cost, " // ") {
+		rest := strings.TrimSpace(half)
+
+		for rest != "" {
+			if rest[0] != '{' {
+				return manaCost, fmt.Errorf("%w: %q", ErrInvalidManaCost, cost)
+			}
+
+			end := strings.IndexByte(rest, '}')
+
+			if end == -1 {
+				return manaCost, fmt.Errorf("%w: %q", ErrInvalidManaCost, cost)
+			}
+
+			symbol, err := parseManaSymbol(rest[1:end])
+
+			if err != nil {
+				return manaCost, fmt.Errorf("%w: %q: %w", ErrInvalidManaCost, cost, err)
+			}
+
+			manaCost.Symbols = append(manaCost.Symbols, *symbol)
+
+			rest = rest[end+1:]
+		}
+	}
+
+	return manaCost, nil
+}
+
+func parseManaSymbol(raw string) (*ManaSymbol, error) {
+	symbol := &ManaSymbol{Symbol: raw}
+
+	parts := strings.Split(raw, "/")
+
+	if len(parts) > 3 {
+		return nil, fmt.Errorf("unknown symbol {%s}", raw)
+	}
+
+	var mana int
+
+	for _, part := range parts {
+		switch {
+		case part == "P" && len(parts) > 1:
+			symbol.Kinds = append(symbol.Kinds, KindPhyrexian)
+		case slices.Contains(manaColors, part):
+			symbol.Colors = append(symbol.Colors, part)
+			mana++
+		case part == "C":
+			symbol.Kinds = append(symbol.Kinds, KindColorless)
+			mana++
+		case part == "S" && len(parts) == 1:
+			symbol.Kinds = append(symbol.Kinds, KindSnow)
+			mana++
+		case part == "X" || part == "Y" || part == "Z":
+			symbol.Kinds = append(symbol.Kinds, KindVariable)
+			mana++
+		default:
+			generic, err := strconv.Atoi(part)
+
+			if err != nil || generic < 0 {
+				return nil, fmt.Errorf("unknown symbol {%s}", raw)
+			}
+
+			symbol.Generic = generic
+			symbol.Kinds = append(symbol.Kinds, KindGeneric)
+			mana++
+		}
+	}
+
+	if mana == 0 {
+		return nil, fmt.Errorf("unknown symbol {%s}", raw)
+	}
+
+	if mana > 1 {
+		symbol.Kinds = append(symbol.Kinds, KindHybrid)
+	}
+
+	if len(symbol.Colors) != 0 {
+		symbol.Kinds = append(symbol.Kinds, KindColored)
+	}
+
+	return symbol, nil
+}
+
+// SymbolNames returns the symbols of the cost without braces, in order, such as
+// ["2", "W/U", "W/U"].
+func (m *ManaCost) SymbolNames() []string {
+	var symbols []string
+
+	for _, s := range m.Symbols {
+		symbols = append(symbols, s.Symbol)
+	}
+
+	return symbols
+}
+
+// Kinds returns every kind of symbol present in the cost, once.
+func (m *ManaCost) Kinds() []string {
+	var kinds []string
+
+	for _, s := range m.Symbols {
+		for _, kind := range s.Kinds {
+			if !slices.Contains(kinds, string(kind)) {
+				kinds = append(kinds, string(kind))
+			}
+		}
+	}
+
+	return kinds
+}
@@ -0,0 +1,121 @@
+package parsing
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestParseManaCost(t *testing.T) {
+	tests := []struct {
+		cost    string
+		symbols []string
+		kinds   []string
+	}{
+		{"", nil, nil},
+		{"{2}{W}{W}", []string{"2", "W", "W"}, []string{"generic", "colored"}},
+		{"{W/U}{W/U}", []string{"W/U", "W/U"}, []string{"hybrid", "colored"}},
+		{"{G/P}", []string{"G/P"}, []string{"phyrexian", "colored"}},
+		{"{W/U/P}", []string{"W/U/P"}, []string{"phyrexian", "hybrid", "colored"}},
+		{"{2/W}{2/W}{2/W}", []string{"2/W", "2/W", "2/W"}, []string{"generic", "hybrid", "colored"}},
+		{"{S}{S}", []string{"S", "S"}, []string{"snow"}},
+		{"{X}{X}{R}", []string{"X", "X", "R"}, []string{"x", "colored"}},
+		{"{C}{C}", []string{"C", "C"}, []string{"colorless"}},
+		{"{0}", []string{"0"}, []string{"generic"}},
+		{"{1}{R} // {2}{G}", []string{"1", "R", "2", "G"}, []string{"generic", "colored"}},
+		{"{R/G} // ", []string{"R/G"}, []string{"hybrid", "colored"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.cost, func(t *testing.T) {
+			cost, err := ParseManaCost(tt.cost)
+
+			if err != nil {
+				t.Fatalf("ParseManaCost(%q) error = %v", tt.cost, err)
+			}
+
+			if got := cost.SymbolNames(); !slices.Equal(got, tt.symbols) {
+				t.Errorf("SymbolNames() = %v, want %v", got, tt.symbols)
+			}
+
+			if got := cost.Kinds(); !slices.Equal(got, tt.kinds) {
+				t.Errorf("Kinds() = %v, want %v", got, tt.kinds)
+			}
+		})
+	}
+}
+
+func TestParseManaSymbol(t *testing.T) {
+	tests := []struct {
+		symbol  string
+		kinds   []SymbolKind
+		colors  []string
+		generic int
+	}{
+		{"12", []SymbolKind{KindGeneric}, nil, 12},
+		{"U", []SymbolKind{KindColored}, []string{"U"}, 0},
+		{"B/G", []SymbolKind{KindHybrid, KindColored}, []string{"B", "G"}, 0},
+		{"2/W", []SymbolKind{KindGeneric, KindHybrid, KindColored}, []string{"W"}, 2},
+		{"C/W", []SymbolKind{KindColorless, KindHybrid, KindColored}, []string{"W"}, 0},
+		{"B/P", []SymbolKind{KindPhyrexian, KindColored}, []string{"B"}, 0},
+		{"G/U/P", []SymbolKind{KindPhyrexian, KindHybrid, KindColored}, []string{"G", "U"}, 0},
+		{"S", []SymbolKind{KindSnow}, nil, 0},
+		{"X", []SymbolKind{KindVariable}, nil, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.symbol, func(t *testing.T) {
+			symbol, err := parseManaSymbol(tt.symbol)
+
+			if err != nil {
+				t.Fatalf("parseManaSymbol(%q) error = %v", tt.symbol, err)
+			}
+
+			if !slices.Equal(symbol.Kinds, tt.kinds) {
+				t.Errorf("Kinds = %v, want %v", symbol.Kinds, tt.kinds)
+			}
+
+			if !slices.Equal(symbol.Colors, tt.colors) {
+				t.Errorf("Colors = %v, want %v", symbol.Colors, tt.colors)
+			}
+
+			if symbol.Generic != tt.generic {
+				t.Errorf("Generic = %d, want %d", symbol.Generic, tt.generic)
+			}
+		})
+	}
+}
+
+func TestParseManaCostRejectsMalformedSymbols(t *testing.T) {
+	tests := []struct {
+		cost    string
+		symbols []string
+	}{
+		{"{W", nil},
+		{"W", nil},
+		{"{}", nil},
+		{"{Q}", nil},
+		{"{P}", nil},
+		{"{S/W}", nil},
+		{"{-1}", nil},
+		{"{W/U/B/G}", nil},
+		{"{1}{G}x", []string{"1", "G"}},
+		{"{1}{Q}{G}", []string{"1"}},
+		{"{R} // {T}", []string{"R"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.cost, func(t *testing.T) {
+			cost, err := ParseManaCost(tt.cost)
+
+			if !errors.Is(err, ErrInvalidManaCost) {
+				t.Fatalf("ParseManaCost(%q) error = %v, want %v", tt.cost, err, ErrInvalidManaCost)
+			}
+
+			// The symbols before the malformed one are still returned.
+			if got := cost.SymbolNames(); !slices.Equal(got, tt.symbols) {
+				t.Errorf("SymbolNames() = %v, want %v", got, tt.symbols)
+			}
+		})
+	}
+}
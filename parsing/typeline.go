@@ -0,0 +1,139 @@
+package parsing
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+var ErrInvalidTypeLine = errors.New("invalid type line")
+
+var supertypes = []string{"Basic", "Legendary", "Ongoing", "Snow", "World", "Elite", "Host", "Token"}
+
+var cardTypes = []string{"Artifact", "Battle", "Conspiracy", "Creature", "Dungeon", "Emblem", "Enchantment",
+	"Hero", "Instant", "Kindred", "Land", "Phenomenon", "Plane", "Planeswalker", "Scheme", "Sorcery",
+	"Tribal", "Vanguard"}
+
+// placeholderTypes appear on the type lines of art series cards and are not
+// types.
+var placeholderTypes = []string{"Card"}
+
+// multiWordSubtypes are the subtypes that contain a space. Every other subtype is
+// a single word.
+var multiWordSubtypes = []string{"Time Lord"}
+
+// typeLineSeparators split the types from the subtypes. Scryfall uses an em dash,
+// some localized printed type lines use other dashes.
+var typeLineSeparators = []string{"—", "–", " - "}
+
+type TypeLine struct {
+	Supertypes []string
+	Types      []string
+	Subtypes   []string
+}
+
+// ParseTypeLine splits an English type line, including the " // " separated type
+// lines of multi-faced cards, into supertypes, card types and subtypes. Words it
+// does not recognize make it return an error along with what it could parse.
+func ParseTypeLine(line string) (*TypeLine, error) {
+	typeLine := &TypeLine{}
+
+	var unknown []string
+
+	for _, half := range strings.Split(line, " // ") {
+		types, subtypes := splitTypeLine(half)
+
+		for _, word := range strings.Fields(types) {
+			switch {
+			case slices.Contains(supertypes, word):
+				typeLine.Supertypes = appendUnique(typeLine.Supertypes, word)
+			case slices.Contains(cardTypes, word):
+				typeLine.Types = appendUnique(typeLine.Types, word)
+			case slices.Contains(placeholderTypes, word):
+			default:
+				unknown = append(unknown, word)
+			}
+		}
+
+		// Plane subtypes are locations such as "Bolas's Meditation Realm".
+		if slices.Contains(strings.Fields(types), "Plane") {
+			if subtypes = strings.TrimSpace(subtypes); subtypes != "" {
+				typeLine.Subtypes = appendUnique(typeLine.Subtypes, subtypes)
+			}
+
+			continue
+		}
+
+		for _, subtype := range splitSubtypes(subtypes) {
+			typeLine.Subtypes = appendUnique(typeLine.Subtypes, subtype)
+		}
+	}
+
+	if len(unknown) != 0 {
+		return typeLine, fmt.Errorf("%w: %q: unknown types %v", ErrInvalidTypeLine, line, unknown)
+	}
+
+	return typeLine, nil
+}
+
+// ParsePrintedSubtypes returns the subtypes of a localized printed type line.
+// Localized types cannot be told apart from each other, so only the part after
+// the dash is used; type lines without one have no subtypes.
+func ParsePrintedSubtypes(line string) []string {
+	var subtypes []string
+
+	for _, half := range strings.Split(line, " // ") {
+		_, rest := splitTypeLine(half)
+
+		for _, subtype := range strings.FieldsFunc(rest, isPrintedSubtypeSeparator) {
+			subtypes = appendUnique(subtypes, subtype)
+		}
+	}
+
+	return subtypes
+}
+
+func splitTypeLine(line string) (string, string) {
+	for _, separator := range typeLineSeparators {
+		if types, subtypes, found := strings.Cut(line, separator); found {
+			return types, subtypes
+		}
+	}
+
+	return line, ""
+}
+
+func splitSubtypes(subtypes string) []string {
+	var split []string
+
+	rest := strings.TrimSpace(subtypes)
+
+	for rest != "" {
+		subtype, next, _ := strings.Cut(rest, " ")
+
+		for _, multiWord := range multiWordSubtypes {
+			if strings.HasPrefix(rest, multiWord+" ") || rest == multiWord {
+				subtype = multiWord
+				next = strings.TrimPrefix(rest, multiWord)
+			}
+		}
+
+		split = append(split, subtype)
+		rest = strings.TrimSpace(next)
+	}
+
+	return split
+}
+
+func isPrintedSubtypeSeparator(r rune) bool {
+	return r == ' ' || r == '・' || r == '·' || r == ','
+}
+
+func appendUnique(values []string, value string) []string {
+	if slices.Contains(values, value) {
+		return values
+	}
+
+	return append(values, value)
+}
@@ -0,0 +1,89 @@
+package parsing
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestParseTypeLine(t *testing.T) {
+	tests := []struct {
+		line       string
+		supertypes []string
+		types      []string
+		subtypes   []string
+	}{
+		{"", nil, nil, nil},
+		{"Instant", nil, []string{"Instant"}, nil},
+		{"Creature — Human Wizard", nil, []string{"Creature"}, []string{"Human", "Wizard"}},
+		{"Basic Snow Land — Forest", []string{"Basic", "Snow"}, []string{"Land"}, []string{"Forest"}},
+		{"Legendary Creature — Time Lord Doctor", []string{"Legendary"}, []string{"Creature"}, []string{"Time Lord", "Doctor"}},
+		{"Legendary Creature — Human Time Lord", []string{"Legendary"}, []string{"Creature"}, []string{"Human", "Time Lord"}},
+		{"Plane — Bolas's Meditation Realm", nil, []string{"Plane"}, []string{"Bolas's Meditation Realm"}},
+		{"Plane — Ravnica", nil, []string{"Plane"}, []string{"Ravnica"}},
+		{"Kindred Instant — Elf", nil, []string{"Kindred", "Instant"}, []string{"Elf"}},
+		{"Tribal Sorcery — Goblin", nil, []string{"Tribal", "Sorcery"}, []string{"Goblin"}},
+		{"Legendary Planeswalker — Jace", []string{"Legendary"}, []string{"Planeswalker"}, []string{"Jace"}},
+		{"Creature — Human Wizard // Creature — Human Insect", nil, []string{"Creature"}, []string{"Human", "Wizard", "Insect"}},
+		{"Instant // Sorcery", nil, []string{"Instant", "Sorcery"}, nil},
+		{"Legendary Enchantment — Saga // Legendary Creature — Human Monk", []string{"Legendary"}, []string{"Enchantment", "Creature"}, []string{"Saga", "Human", "Monk"}},
+		{"Card // Card", nil, nil, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			typeLine, err := ParseTypeLine(tt.line)
+
+			if err != nil {
+				t.Fatalf("ParseTypeLine(%q) error = %v", tt.line, err)
+			}
+
+			if !slices.Equal(typeLine.Supertypes, tt.supertypes) {
+				t.Errorf("Supertypes = %v, want %v", typeLine.Supertypes, tt.supertypes)
+			}
+
+			if !slices.Equal(typeLine.Types, tt.types) {
+				t.Errorf("Types = %v, want %v", typeLine.Types, tt.types)
+			}
+
+			if !slices.Equal(typeLine.Subtypes, tt.subtypes) {
+				t.Errorf("Subtypes = %v, want %v", typeLine.Subtypes, tt.subtypes)
+			}
+		})
+	}
+}
+
+func TestParseTypeLineReportsUnknownTypes(t *testing.T) {
+	typeLine, err := ParseTypeLine("Legendary Widget — Gizmo")
+
+	if !errors.Is(err, ErrInvalidTypeLine) {
+		t.Fatalf("ParseTypeLine() error = %v, want %v", err, ErrInvalidTypeLine)
+	}
+
+	// What could be parsed is still returned.
+	if !slices.Equal(typeLine.Supertypes, []string{"Legendary"}) || !slices.Equal(typeLine.Subtypes, []string{"Gizmo"}) {
+		t.Errorf("ParseTypeLine() = %+v, want the Legendary supertype and the Gizmo subtype", typeLine)
+	}
+}
+
+func TestParsePrintedSubtypes(t *testing.T) {
+	tests := []struct {
+		line     string
+		subtypes []string
+	}{
+		{"Éphémère", nil},
+		{"Criatura — Humano Mago", []string{"Humano", "Mago"}},
+		{"Kreatur – Mensch, Zauberer", []string{"Mensch", "Zauberer"}},
+		{"Créature - Humain", []string{"Humain"}},
+		{"クリーチャー — 人間・ウィザード", []string{"人間", "ウィザード"}},
+		{"Criatura — Humano Mago // Criatura — Humano Inseto", []string{"Humano", "Mago", "Inseto"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			if got := ParsePrintedSubtypes(tt.line); !slices.Equal(got, tt.subtypes) {
+				t.Errorf("ParsePrintedSubtypes(%q) = %v, want %v", tt.line, got, tt.subtypes)
+			}
+		})
+	}
+}
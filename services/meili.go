@@ -1,89 +1,591 @@
 package services
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/meilisearch/meilisearch-go"
+	"spellscan.com/card-loader/config"
 	"spellscan.com/card-loader/objects"
+	"spellscan.com/card-loader/parsing"
 )
 
 const cardsIndexName = "cards"
 
+const tokensIndexName = "tokens"
+
 var ErrTaskFailed = errors.New("task failed")
 
+var ErrDocumentCountMismatch = errors.New("staging index document count does not match the number of documents sent")
+
+var ErrNoStagingIndex = errors.New("no staging index was created")
+
+// TaskError describes a Meilisearch task that finished with a failed or canceled
+// status. It matches ErrTaskFailed with errors.Is.
+type TaskError struct {
+	TaskUID  int64
+	IndexUID string
+	Type     string
+	Status   string
+	Code     string
+	Message  string
+}
+
+func (e *TaskError) Error() string {
+	return fmt.Sprintf("meilisearch task %d (%s on %s) %s: %s: %s", e.TaskUID, e.Type, e.IndexUID, e.Status, e.Code, e.Message)
+}
+
+func (e *TaskError) Is(target error) bool {
+	return target == ErrTaskFailed
+}
+
+// MeiliService writes to the staging index once CreateStagingIndex has been called
+// and directly to the live index otherwise.
 type MeiliService interface {
-	SaveAll(cards []*objects.Card) error
-	UpdateIndexes() error
-	DeleteAll() error
+	HasLiveIndex() (bool, error)
+	CreateStagingIndex(ctx context.Context) error
+	SaveAll(ctx context.Context, cards []*objects.Card) error
+	UpdateIndexes(ctx context.Context) error
+	DeleteCards(ctx context.Context, ids []string) error
+	UpdateTokenIndex(ctx context.Context) error
+	SaveTokens(ctx context.Context, cards []*objects.Card) error
+	DeleteTokens(ctx context.Context, ids []string) error
+	Wait(ctx context.Context) error
+	SwapIndexes(ctx context.Context) error
+	DiscardStagingIndex(ctx context.Context) error
+	PruneIndexes(ctx context.Context) error
 }
 
 type meiliService struct {
-	client *meilisearch.Client
+	client       *meilisearch.Client
+	cfg          *config.Config
+	stagingIndex string
+	pending      []int64
+	documents    int64
 }
 
-func NewMeiliService(client *meilisearch.Client) MeiliService {
-	return &meiliService{client: client}
+func NewMeiliService(client *meilisearch.Client, cfg *config.Config) MeiliService {
+	return &meiliService{client: client, cfg: cfg}
 }
 
-func (m *meiliService) SaveAll(cards []*objects.Card) error {
+func (m *meiliService) HasLiveIndex() (bool, error) {
+	_, err := m.client.GetIndex(cardsIndexName)
+
+	if err == nil {
+		return true, nil
+	}
+
+	var meiliErr *meilisearch.Error
+
+	if errors.As(err, &meiliErr) && meiliErr.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+
+	return false, err
+}
+
+func (m *meiliService) CreateStagingIndex(ctx context.Context) error {
+	name := fmt.Sprintf("%s_%d", cardsIndexName, time.Now().Unix())
+
+	res, err := m.client.CreateIndex(&meilisearch.IndexConfig{
+		Uid:        name,
+		PrimaryKey: "id",
+	})
+
+	if err != nil {
+		return err
+	}
+
+	if err := m.waitForTask(ctx, res.TaskUID); err != nil {
+		return err
+	}
+
+	m.stagingIndex = name
+	m.documents = 0
+
+	slog.Info("Created staging index", "index", name)
+
+	return nil
+}
+
+func (m *meiliService) SaveAll(ctx context.Context, cards []*objects.Card) error {
 	var searchCards []*objects.CardSearch
 
 	for _, card := range cards {
-		cardSearch := &objects.CardSearch{
-			ID:   card.ID,
-			Name: card.Name,
-			Set:  card.Set,
-		}
+		searchCards = append(searchCards, toCardSearch(card))
+	}
 
-		if card.PrintedName != "" {
-			cardSearch.Name = card.PrintedName
-		}
+	res, err := m.client.Index(m.targetIndex()).AddDocuments(searchCards)
 
-		if card.PrintedText == "" {
-			cardSearch.Text = card.OracleText
-		}
+	if err != nil {
+		return err
+	}
+
+	m.documents += int64(len(searchCards))
 
-		searchCards = append(searchCards, cardSearch)
+	return m.enqueue(ctx, res.TaskUID)
+}
+
+func (m *meiliService) UpdateIndexes(ctx context.Context) error {
+	resp, err := m.client.Index(m.targetIndex()).UpdateSettings(searchSettings())
+
+	if err != nil {
+		return err
 	}
 
-	res, err := m.client.Index(cardsIndexName).AddDocuments(searchCards)
+	return m.enqueue(ctx, resp.TaskUID)
+}
+
+// UpdateTokenIndex applies the search settings to the tokens index, creating it
+// if it does not exist yet.
+func (m *meiliService) UpdateTokenIndex(ctx context.Context) error {
+	resp, err := m.client.Index(tokensIndexName).UpdateSettings(searchSettings())
 
 	if err != nil {
 		return err
 	}
 
-	if res.Status == meilisearch.TaskStatusFailed {
-		return ErrTaskFailed
+	return m.enqueue(ctx, resp.TaskUID)
+}
+
+// SaveTokens writes tokens, emblems and art series cards to the tokens index,
+// which is always updated in place.
+func (m *meiliService) SaveTokens(ctx context.Context, cards []*objects.Card) error {
+	var searchCards []*objects.CardSearch
+
+	for _, card := range cards {
+		searchCards = append(searchCards, toTokenSearch(card))
+	}
+
+	res, err := m.client.Index(tokensIndexName).AddDocuments(searchCards)
+
+	if err != nil {
+		return err
+	}
+
+	return m.enqueue(ctx, res.TaskUID)
+}
+
+func (m *meiliService) DeleteTokens(ctx context.Context, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	res, err := m.client.Index(tokensIndexName).DeleteDocuments(ids)
+
+	if err != nil {
+		return err
+	}
+
+	return m.enqueue(ctx, res.TaskUID)
+}
+
+// searchSettings are shared by the cards and tokens indexes, so that a client can
+// query both the same way.
+func searchSettings() *meilisearch.Settings {
+	return &meilisearch.Settings{
+		SearchableAttributes: []string{
+			"printed_name",
+			"oracle_name",
+			"faces.printed_name",
+			"faces.name",
+			"type_line",
+			"faces.type_line",
+			"printed_text",
+			"oracle_text",
+			"faces.printed_text",
+			"faces.oracle_text",
+			"keywords",
+			"artist",
+			"faces.artist",
+		},
+		FilterableAttributes: []string{
+			"set",
+			"type_line",
+			"colors",
+			"color_identity",
+			"cmc",
+			"rarity",
+			"lang",
+			"layout",
+			"collector_number",
+			"artist",
+			"keywords",
+			"legalities",
+			"legal_formats",
+			"supertypes",
+			"card_types",
+			"subtypes",
+			"printed_subtypes",
+			"mana_kinds",
+			"created_by",
+		},
+		SortableAttributes: []string{
+			"name",
+			"cmc",
+			"rarity",
+			"collector_number",
+		},
+	}
+}
+
+func (m *meiliService) DeleteCards(ctx context.Context, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	res, err := m.client.Index(m.targetIndex()).DeleteDocuments(ids)
+
+	if err != nil {
+		return err
+	}
+
+	return m.enqueue(ctx, res.TaskUID)
+}
+
+// Wait blocks until every task enqueued by the service has finished, returning the
+// first failure. It is the barrier to cross before a job is considered successful.
+func (m *meiliService) Wait(ctx context.Context) error {
+	for len(m.pending) > 0 {
+		if err := m.waitOldest(ctx); err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
-func (m *meiliService) UpdateIndexes() error {
-	resp, err := m.client.Index(cardsIndexName).UpdateFilterableAttributes(&[]string{
-		"set",
+// SwapIndexes waits for the staging index to settle, checks that every document
+// sent was indexed and atomically swaps it with the live index. After the swap the
+// staging name holds the previous documents, which are kept for rollback.
+func (m *meiliService) SwapIndexes(ctx context.Context) error {
+	if m.stagingIndex == "" {
+		return ErrNoStagingIndex
+	}
+
+	if err := m.Wait(ctx); err != nil {
+		return err
+	}
+
+	stats, err := m.client.Index(m.stagingIndex).GetStats()
+
+	if err != nil {
+		return err
+	}
+
+	if stats.NumberOfDocuments != m.documents {
+		slog.Error("Staging index is incomplete", "index", m.stagingIndex, "expected", m.documents, "indexed", stats.NumberOfDocuments)
+		return ErrDocumentCountMismatch
+	}
+
+	if err := m.ensureLiveIndex(ctx); err != nil {
+		return err
+	}
+
+	res, err := m.client.SwapIndexes([]meilisearch.SwapIndexesParams{
+		{Indexes: []string{cardsIndexName, m.stagingIndex}},
 	})
 
 	if err != nil {
 		return err
 	}
 
-	if resp.Status == meilisearch.TaskStatusFailed {
-		return ErrTaskFailed
+	if err := m.waitForTask(ctx, res.TaskUID); err != nil {
+		return err
 	}
 
+	slog.Info("Swapped staging index into live index", "staging", m.stagingIndex, "live", cardsIndexName, "documents", m.documents)
+
+	m.stagingIndex = ""
+
 	return nil
 }
 
-func (m *meiliService) DeleteAll() error {
-	res, err := m.client.Index(cardsIndexName).DeleteAllDocuments()
+// DiscardStagingIndex deletes a staging index that was not swapped in, leaving the
+// live index untouched.
+func (m *meiliService) DiscardStagingIndex(ctx context.Context) error {
+	if m.stagingIndex == "" {
+		return nil
+	}
+
+	res, err := m.client.DeleteIndex(m.stagingIndex)
 
 	if err != nil {
 		return err
 	}
 
-	if res.Status == meilisearch.TaskStatusFailed {
-		return ErrTaskFailed
+	slog.Info("Discarded staging index", "index", m.stagingIndex)
+
+	m.stagingIndex = ""
+	m.pending = nil
+
+	return m.waitForTask(ctx, res.TaskUID)
+}
+
+// PruneIndexes deletes previous generations of the cards index, keeping the
+// newest MEILI_KEEP_INDEXES of them around for rollback.
+func (m *meiliService) PruneIndexes(ctx context.Context) error {
+	previous, err := m.previousIndexes()
+
+	if err != nil {
+		return err
+	}
+
+	if len(previous) <= m.cfg.MeiliKeepIndexes {
+		return nil
+	}
+
+	for _, name := range previous[m.cfg.MeiliKeepIndexes:] {
+		res, err := m.client.DeleteIndex(name)
+
+		if err != nil {
+			return err
+		}
+
+		if err := m.waitForTask(ctx, res.TaskUID); err != nil {
+			return err
+		}
+
+		slog.Info("Deleted previous index", "index", name)
+	}
+
+	return nil
+}
+
+func toCardSearch(card *objects.Card) *objects.CardSearch {
+	cardSearch := &objects.CardSearch{
+		ID:              card.ID,
+		Name:            card.Name,
+		Text:            card.OracleText,
+		OracleName:      card.Name,
+		PrintedName:     card.PrintedName,
+		OracleText:      card.OracleText,
+		PrintedText:     card.PrintedText,
+		Set:             card.Set,
+		TypeLine:        card.TypeLine,
+		Colors:          card.Colors,
+		ColorIdentity:   card.ColorIdentity,
+		CMC:             card.CMC,
+		Rarity:          card.Rarity,
+		Lang:            card.Lang,
+		Layout:          card.Layout,
+		CollectorNumber: card.CollectorNumber,
+		Artist:          card.Artist,
+		Keywords:        card.Keywords,
+		Legalities:      card.Legalities,
+		LegalFormats:    legalFormats(card.Legalities),
+		Thumbnail:       card.ImageUris.Small,
+	}
+
+	// Parse errors are logged when the card is mapped for the database, the parts
+	// that could be parsed are still indexed.
+	parsed, _ := parsing.ParseCard(card)
+
+	cardSearch.Supertypes = parsed.TypeLine.Supertypes
+	cardSearch.CardTypes = parsed.TypeLine.Types
+	cardSearch.Subtypes = parsed.TypeLine.Subtypes
+	cardSearch.PrintedSubtypes = parsed.PrintedSubtypes
+	cardSearch.ManaSymbols = parsed.ManaCost.SymbolNames()
+	cardSearch.ManaKinds = parsed.ManaCost.Kinds()
+
+	if card.PrintedName != "" {
+		cardSearch.Name = card.PrintedName
+	}
+
+	if card.PrintedText != "" {
+		cardSearch.Text = card.PrintedText
+	}
+
+	for _, face := range card.CardFaces {
+		cardSearch.Faces = append(cardSearch.Faces, objects.CardFaceSearch{
+			Name:        face.Name,
+			PrintedName: face.PrintedName,
+			OracleText:  face.OracleText,
+			PrintedText: face.PrintedText,
+			ManaCost:    face.ManaCost,
+			TypeLine:    face.TypeLine,
+			Colors:      face.Colors,
+			Artist:      face.Artist,
+			Thumbnail:   face.ImageUris.Small,
+		})
+
+		// Double-faced layouts carry colors and images on the faces only.
+		if card.Colors == nil {
+			cardSearch.Colors = appendMissing(cardSearch.Colors, face.Colors)
+		}
+
+		if cardSearch.Thumbnail == "" {
+			cardSearch.Thumbnail = face.ImageUris.Small
+		}
+	}
+
+	return cardSearch
+}
+
+// toTokenSearch indexes a token like a card, adding the names of the cards that
+// create it.
+func toTokenSearch(card *objects.Card) *objects.CardSearch {
+	cardSearch := toCardSearch(card)
+
+	for _, part := range card.AllParts {
+		if part.ID != card.ID && part.Component == objects.ComponentComboPiece {
+			cardSearch.CreatedBy = appendMissing(cardSearch.CreatedBy, []string{part.Name})
+		}
+	}
+
+	return cardSearch
+}
+
+// legalFormats lists the formats a card can be played in, restricted included, so
+// that "legal in pioneer" is a single filter on legal_formats.
+func legalFormats(legalities objects.Legalities) []string {
+	var formats []string
+
+	for format, status := range legalities {
+		if status == "legal" || status == "restricted" {
+			formats = append(formats, format)
+		}
+	}
+
+	sort.Strings(formats)
+
+	return formats
+}
+
+func appendMissing(values []string, candidates []string) []string {
+	for _, candidate := range candidates {
+		found := false
+
+		for _, value := range values {
+			if value == candidate {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			values = append(values, candidate)
+		}
+	}
+
+	return values
+}
+
+// previousIndexes lists generations of the cards index other than the live one
+// and the current staging one, newest first.
+func (m *meiliService) previousIndexes() ([]string, error) {
+	var names []string
+
+	var offset int64
+
+	for {
+		res, err := m.client.GetIndexes(&meilisearch.IndexesQuery{Limit: 100, Offset: offset})
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, index := range res.Results {
+			if !strings.HasPrefix(index.UID, cardsIndexName+"_") || index.UID == m.stagingIndex {
+				continue
+			}
+
+			names = append(names, index.UID)
+		}
+
+		offset += int64(len(res.Results))
+
+		if len(res.Results) == 0 || offset >= res.Total {
+			break
+		}
+	}
+
+	sort.Sort(sort.Reverse(sort.StringSlice(names)))
+
+	return names, nil
+}
+
+func (m *meiliService) targetIndex() string {
+	if m.stagingIndex != "" {
+		return m.stagingIndex
+	}
+
+	return cardsIndexName
+}
+
+// ensureLiveIndex creates an empty live index on the first run, since Meilisearch
+// can only swap indexes that already exist.
+func (m *meiliService) ensureLiveIndex(ctx context.Context) error {
+	exists, err := m.HasLiveIndex()
+
+	if err != nil || exists {
+		return err
+	}
+
+	res, err := m.client.CreateIndex(&meilisearch.IndexConfig{
+		Uid:        cardsIndexName,
+		PrimaryKey: "id",
+	})
+
+	if err != nil {
+		return err
+	}
+
+	return m.waitForTask(ctx, res.TaskUID)
+}
+
+// enqueue tracks a task without waiting for it, so batches keep flowing while
+// Meilisearch indexes the previous ones. Only when MEILI_MAX_PENDING_TASKS tasks are
+// in flight does it wait for the oldest one.
+func (m *meiliService) enqueue(ctx context.Context, taskUID int64) error {
+	m.pending = append(m.pending, taskUID)
+
+	for len(m.pending) > m.cfg.MeiliMaxPendingTasks {
+		if err := m.waitOldest(ctx); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m *meiliService) waitOldest(ctx context.Context) error {
+	taskUID := m.pending[0]
+	m.pending = m.pending[1:]
+
+	return m.waitForTask(ctx, taskUID)
+}
+
+// waitForTask waits for taskUID for at most MEILI_TASK_TIMEOUT, and no longer
+// than ctx allows.
+func (m *meiliService) waitForTask(ctx context.Context, taskUID int64) error {
+	ctx, cancel := context.WithTimeout(ctx, m.cfg.MeiliTaskTimeout)
+	defer cancel()
+
+	task, err := m.client.WaitForTask(taskUID, meilisearch.WaitParams{
+		Context:  ctx,
+		Interval: m.cfg.MeiliPollInterval,
+	})
+
+	if err != nil {
+		return fmt.Errorf("waiting for meilisearch task %d: %w", taskUID, err)
+	}
+
+	if task.Status != meilisearch.TaskStatusSucceeded {
+		return &TaskError{
+			TaskUID:  taskUID,
+			IndexUID: task.IndexUID,
+			Type:     string(task.Type),
+			Status:   string(task.Status),
+			Code:     task.Error.Code,
+			Message:  task.Error.Message,
+		}
 	}
 
 	return nil
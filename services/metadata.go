@@ -1,13 +1,18 @@
 package services
 
 import (
+	"compress/gzip"
+	"context"
 	"database/sql"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"log/slog"
+	"math/rand"
 	"net/http"
 	"os"
+	"path/filepath"
 	"time"
 
 	"github.com/jmoiron/sqlx"
@@ -16,29 +21,39 @@ import (
 	"spellscan.com/card-loader/objects"
 )
 
-const scryfallBaseUrl = "https://api.scryfall.com/bulk-data"
+const maxDownloadBackoff = time.Minute
 
 var ErrScryfallNotAvailable = errors.New("scryfall is not available")
 
+var ErrBulkTypeNotFound = errors.New("bulk data type not available")
+
+var ErrBulkSizeMismatch = errors.New("downloaded bulk data size does not match bulk metadata")
+
 type MetadataService interface {
-	GetLastJobResult() (*models.JobResult, error)
-	GetRemoteBulkMetadata() (*objects.BulkMetadata, error)
-	DownloadBulkFile(data *objects.BulkMetadata) error
-	Save(bm *objects.BulkMetadata, start time.Time, end time.Time) error
+	GetLastJobResult(bulkType string, jobMode string) (*models.JobResult, error)
+	LastJobSucceeded(bulkType string, jobMode string) (bool, error)
+	GetRemoteBulkMetadata(ctx context.Context, bulkType string) (*objects.BulkMetadata, error)
+	GetRemoteSets(ctx context.Context) ([]objects.Set, error)
+	DownloadBulkFile(ctx context.Context, data *objects.BulkMetadata) error
+	OpenBulkFile(ctx context.Context, data *objects.BulkMetadata) (io.ReadCloser, error)
+	Save(bm *objects.BulkMetadata, jr *models.JobResult) error
 }
 
 type metadataService struct {
-	db  *sqlx.DB
-	cfg *config.Config
+	db     *sqlx.DB
+	cfg    *config.Config
+	client *http.Client
 }
 
-func NewMetadataService(db *sqlx.DB, cfg *config.Config) MetadataService {
-	return &metadataService{db: db, cfg: cfg}
+func NewMetadataService(db *sqlx.DB, cfg *config.Config, client *http.Client) MetadataService {
+	return &metadataService{db: db, cfg: cfg, client: client}
 }
 
-func (m *metadataService) GetLastJobResult() (*models.JobResult, error) {
+func (m *metadataService) GetLastJobResult(bulkType string, jobMode string) (*models.JobResult, error) {
 	var jobResult models.JobResult
-	err := m.db.Get(&jobResult, "SELECT * FROM job_results ORDER BY reference_date DESC LIMIT 1")
+
+	// Failed and cancelled jobs are ignored, so their bulk data is loaded again.
+	err := m.db.Get(&jobResult, "SELECT * FROM job_results WHERE bulk_type = $1 AND job_mode = $2 AND status = $3 ORDER BY reference_date DESC LIMIT 1", bulkType, jobMode, models.JobStatusSucceeded)
 
 	if err == sql.ErrNoRows {
 		return &models.JobResult{}, nil
@@ -51,13 +66,33 @@ func (m *metadataService) GetLastJobResult() (*models.JobResult, error) {
 	return &jobResult, nil
 }
 
-func (m *metadataService) GetRemoteBulkMetadata() (*objects.BulkMetadata, error) {
-	res, err := http.Get(scryfallBaseUrl)
+// LastJobSucceeded reports whether the latest job of jobMode for bulkType, whatever
+// its outcome, succeeded. It is true when there is no job yet.
+func (m *metadataService) LastJobSucceeded(bulkType string, jobMode string) (bool, error) {
+	var status string
+
+	err := m.db.Get(&status, "SELECT status FROM job_results WHERE bulk_type = $1 AND job_mode = $2 ORDER BY finished DESC LIMIT 1", bulkType, jobMode)
+
+	if err == sql.ErrNoRows {
+		return true, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	return status == models.JobStatusSucceeded, nil
+}
+
+func (m *metadataService) GetRemoteBulkMetadata(ctx context.Context, bulkType string) (*objects.BulkMetadata, error) {
+	res, err := m.get(ctx, m.cfg.ScryfallBaseUrl+"/bulk-data")
 
 	if err != nil {
 		return nil, err
 	}
 
+	defer res.Body.Close()
+
 	if res.StatusCode != http.StatusOK {
 		return nil, ErrScryfallNotAvailable
 	}
@@ -68,66 +103,306 @@ func (m *metadataService) GetRemoteBulkMetadata() (*objects.BulkMetadata, error)
 		return nil, err
 	}
 
-	var bulkMetadata objects.BulkMetadata
-
 	for _, object := range root.Data {
-		if object.Type == "all_cards" {
-			bulkMetadata = object
+		if object.Type == bulkType {
+			return &object, nil
 		}
 	}
 
-	return &bulkMetadata, nil
+	return nil, fmt.Errorf("%w: %s", ErrBulkTypeNotFound, bulkType)
 }
 
-func (m *metadataService) DownloadBulkFile(data *objects.BulkMetadata) error {
+// GetRemoteSets fetches every set from Scryfall, following next_page while
+// has_more is set.
+func (m *metadataService) GetRemoteSets(ctx context.Context) ([]objects.Set, error) {
+	var sets []objects.Set
+
+	next := m.cfg.ScryfallBaseUrl + "/sets"
+
+	for next != "" {
+		page, err := m.getSetList(ctx, next)
+
+		if err != nil {
+			return nil, err
+		}
+
+		sets = append(sets, page.Data...)
+
+		next = ""
+
+		if page.HasMore {
+			next = page.NextPage
+		}
+	}
+
+	return sets, nil
+}
+
+func (m *metadataService) getSetList(ctx context.Context, uri string) (*objects.SetList, error) {
+	res, err := m.get(ctx, uri)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, ErrScryfallNotAvailable
+	}
+
+	var page objects.SetList
+
+	if err := json.NewDecoder(res.Body).Decode(&page); err != nil {
+		return nil, err
+	}
+
+	return &page, nil
+}
+
+// DownloadBulkFile downloads the bulk file into a .part file, resuming it with
+// HTTP Range requests after dropped connections, and only renames it into place
+// once its size matches the one advertised in the bulk metadata.
+func (m *metadataService) DownloadBulkFile(ctx context.Context, data *objects.BulkMetadata) error {
 	if m.cfg.SkipDownload {
 		slog.Info("Skipping Download")
 		return nil
 	}
 
-	if err := os.Mkdir("tmp", 0700); err != nil {
-		if !os.IsExist(err) {
-			return err
+	if err := os.MkdirAll(m.cfg.BulkCacheDir, 0700); err != nil {
+		return err
+	}
+
+	// Parts are named after the bulk file version so that a part left behind by an
+	// older version is never resumed.
+	partPath := fmt.Sprintf("%s.%d.part", m.bulkFilePath(data), data.UpdatedAt.Unix())
+
+	m.removeStaleParts(data, partPath)
+
+	start := time.Now()
+
+	slog.Info("Starting downloading bulk data", "start", start)
+
+	var err error
+
+	for attempt := 0; attempt <= m.cfg.DownloadMaxRetries; attempt++ {
+		if attempt > 0 {
+			delay := backoff(m.cfg.DownloadRetryBackoff, attempt)
+			slog.Warn("Retrying bulk data download", "attempt", attempt, "delay", delay, "err", err)
+
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(delay):
+			}
+		}
+
+		if err = m.downloadPart(ctx, data.DownloadURI, partPath); err == nil {
+			break
+		}
+
+		// The part file is kept, so a cancelled download resumes on the next run.
+		if ctx.Err() != nil {
+			return ctx.Err()
 		}
 	}
 
-	out, err := os.Create("./tmp/bulk_data.json")
+	if err != nil {
+		return err
+	}
+
+	info, err := os.Stat(partPath)
 
 	if err != nil {
 		return err
 	}
 
-	defer out.Close()
+	if data.Size > 0 && info.Size() != int64(data.Size) {
+		slog.Error("Downloaded bulk data has unexpected size", "expected", data.Size, "actual", info.Size())
+		return errors.Join(ErrBulkSizeMismatch, os.Remove(partPath))
+	}
 
-	start := time.Now()
+	slog.Info("Finished download bulk data", "duration", time.Now().Unix()-start.Unix())
 
-	slog.Info("Starting downloading bulk data", "start", start)
+	return os.Rename(partPath, m.bulkFilePath(data))
+}
+
+func (m *metadataService) removeStaleParts(data *objects.BulkMetadata, keep string) {
+	parts, _ := filepath.Glob(m.bulkFilePath(data) + ".*.part")
 
-	res, err := http.Get(data.DownloadURI)
+	for _, part := range parts {
+		if part == keep {
+			continue
+		}
+
+		if err := os.Remove(part); err != nil {
+			slog.Warn("Could not remove stale partial download", "path", part, "err", err)
+		}
+	}
+}
+
+// downloadPart appends the rest of the file at uri to the part file at path.
+func (m *metadataService) downloadPart(ctx context.Context, uri string, path string) error {
+	var offset int64
+
+	if info, err := os.Stat(path); err == nil {
+		offset = info.Size()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
 
 	if err != nil {
 		return err
 	}
 
-	if res.StatusCode != http.StatusOK {
-		return ErrScryfallNotAvailable
+	// Ranges refer to the encoded representation, so ask for the plain file.
+	req.Header.Set("Accept-Encoding", "identity")
+
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	res, err := m.client.Do(req)
+
+	if err != nil {
+		return err
 	}
 
 	defer res.Body.Close()
 
+	flags := os.O_CREATE | os.O_WRONLY
+
+	switch res.StatusCode {
+	case http.StatusOK:
+		flags |= os.O_TRUNC
+	case http.StatusPartialContent:
+		flags |= os.O_APPEND
+		slog.Info("Resuming bulk data download", "offset", offset)
+	case http.StatusRequestedRangeNotSatisfiable:
+		// The part file already holds the whole file; its size is verified next.
+		return nil
+	default:
+		return ErrScryfallNotAvailable
+	}
+
+	out, err := os.OpenFile(path, flags, 0600)
+
+	if err != nil {
+		return err
+	}
+
 	_, err = io.Copy(out, res.Body)
 
-	slog.Info("Finished download bulk data", "duration", time.Now().Unix()-start.Unix())
+	return errors.Join(err, out.Close())
+}
 
-	return err
+func (m *metadataService) get(ctx context.Context, uri string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return m.client.Do(req)
 }
 
-func (m *metadataService) Save(bm *objects.BulkMetadata, start time.Time, end time.Time) error {
-	jr := &models.JobResult{
-		Size:          bm.Size,
-		ReferenceDate: bm.UpdatedAt,
-		Started:       start,
-		Finished:      end,
+func backoff(base time.Duration, attempt int) time.Duration {
+	delay := base * time.Duration(1<<(attempt-1))
+
+	if delay > maxDownloadBackoff {
+		delay = maxDownloadBackoff
+	}
+
+	return delay + time.Duration(rand.Int63n(int64(delay)/2+1))
+}
+
+// OpenBulkFile returns the bulk data as a JSON stream. When BULK_STREAM is set the
+// cards are decoded while the HTTP body arrives, optionally teeing the decoded
+// bytes into the cache directory; otherwise the file is downloaded first.
+func (m *metadataService) OpenBulkFile(ctx context.Context, data *objects.BulkMetadata) (io.ReadCloser, error) {
+	if m.cfg.SkipDownload || !m.cfg.BulkStream {
+		if err := m.DownloadBulkFile(ctx, data); err != nil {
+			return nil, err
+		}
+
+		return os.Open(m.bulkFilePath(data))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, data.DownloadURI, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// Asking for gzip explicitly disables the transport's transparent
+	// decompression, so the body is decompressed below.
+	req.Header.Set("Accept-Encoding", "gzip")
+
+	res, err := m.client.Do(req)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		res.Body.Close()
+		return nil, ErrScryfallNotAvailable
+	}
+
+	stream := &bulkStream{body: res.Body, reader: res.Body}
+
+	// The size in the bulk metadata is the one of the uncompressed file, which an
+	// encoded body only matches once decompressed.
+	switch res.Header.Get("Content-Encoding") {
+	case "":
+		stream.size = int64(data.Size)
+	case "gzip":
+		gz, err := gzip.NewReader(res.Body)
+
+		if err != nil {
+			res.Body.Close()
+			return nil, err
+		}
+
+		stream.gz = gz
+		stream.reader = gz
+	}
+
+	if m.cfg.BulkStreamCache {
+		if err := os.MkdirAll(m.cfg.BulkCacheDir, 0700); err != nil {
+			res.Body.Close()
+			return nil, err
+		}
+
+		cache, err := os.Create(m.bulkFilePath(data) + ".part")
+
+		if err != nil {
+			res.Body.Close()
+			return nil, err
+		}
+
+		stream.cache = cache
+		stream.cachePath = m.bulkFilePath(data)
+		stream.reader = io.TeeReader(stream.reader, cache)
+	}
+
+	slog.Info("Streaming bulk data", "uri", data.DownloadURI, "cache", m.cfg.BulkStreamCache)
+
+	return stream, nil
+}
+
+func (m *metadataService) bulkFilePath(data *objects.BulkMetadata) string {
+	return filepath.Join(m.cfg.BulkCacheDir, data.Type+".json")
+}
+
+func (m *metadataService) Save(bm *objects.BulkMetadata, jr *models.JobResult) error {
+	jr.Size = bm.Size
+	jr.BulkID = bm.ID
+	jr.BulkType = bm.Type
+	jr.ReferenceDate = bm.UpdatedAt
+
+	if jr.JobMode == "" {
+		jr.JobMode = config.JobModeCards
 	}
 
 	if err := jr.Save(m.db); err != nil {
@@ -136,3 +411,59 @@ func (m *metadataService) Save(bm *objects.BulkMetadata, start time.Time, end ti
 
 	return nil
 }
+
+// bulkStream reads a bulk data HTTP body and, when caching, only promotes the
+// cached copy once the body has been read to the end and, when size is known, has
+// the expected size.
+type bulkStream struct {
+	body      io.ReadCloser
+	gz        *gzip.Reader
+	reader    io.Reader
+	cache     *os.File
+	cachePath string
+	size      int64
+	read      int64
+	complete  bool
+}
+
+func (b *bulkStream) Read(p []byte) (int, error) {
+	n, err := b.reader.Read(p)
+
+	b.read += int64(n)
+
+	if err == io.EOF {
+		b.complete = true
+	}
+
+	return n, err
+}
+
+func (b *bulkStream) Close() error {
+	var err error
+
+	if b.gz != nil {
+		err = b.gz.Close()
+	}
+
+	err = errors.Join(err, b.body.Close())
+
+	if b.cache == nil {
+		return err
+	}
+
+	if cacheErr := b.cache.Close(); cacheErr != nil {
+		return cacheErr
+	}
+
+	if !b.complete {
+		slog.Warn("Bulk data stream was not read to the end, discarding cache", "path", b.cache.Name())
+		return errors.Join(err, os.Remove(b.cache.Name()))
+	}
+
+	if b.size > 0 && b.read != b.size {
+		slog.Error("Streamed bulk data has unexpected size, discarding cache", "expected", b.size, "actual", b.read)
+		return errors.Join(err, ErrBulkSizeMismatch, os.Remove(b.cache.Name()))
+	}
+
+	return errors.Join(err, os.Rename(b.cache.Name(), b.cachePath))
+}
@@ -0,0 +1,287 @@
+package services
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"spellscan.com/card-loader/config"
+	"spellscan.com/card-loader/objects"
+)
+
+var bulkBody = bytes.Repeat([]byte(`{"object":"card"},`), 4096)
+
+// bulkServer serves body, honouring Range requests unless ignoreRange is set, and
+// cuts the connection after cutAt bytes of the first response when cutAt > 0. It
+// records the Range header of every request.
+type bulkServer struct {
+	body        []byte
+	cutAt       int
+	ignoreRange bool
+	mu          sync.Mutex
+	ranges      []string
+}
+
+func (s *bulkServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.ranges = append(s.ranges, r.Header.Get("Range"))
+	first := len(s.ranges) == 1
+	s.mu.Unlock()
+
+	var offset int
+
+	if rng := r.Header.Get("Range"); rng != "" && !s.ignoreRange {
+		if _, err := fmt.Sscanf(rng, "bytes=%d-", &offset); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", offset, len(s.body)-1, len(s.body)))
+		w.Header().Set("Content-Length", strconv.Itoa(len(s.body)-offset))
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write(s.body[offset:])
+
+		return
+	}
+
+	w.Header().Set("Content-Length", strconv.Itoa(len(s.body)))
+	w.WriteHeader(http.StatusOK)
+
+	if first && s.cutAt > 0 {
+		w.Write(s.body[:s.cutAt])
+		w.(http.Flusher).Flush()
+		panic(http.ErrAbortHandler)
+	}
+
+	w.Write(s.body)
+}
+
+func (s *bulkServer) requestedRanges() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return slices.Clone(s.ranges)
+}
+
+func newDownloadTest(t *testing.T, server *bulkServer, size int) (*metadataService, *objects.BulkMetadata) {
+	t.Helper()
+
+	srv := httptest.NewServer(server)
+
+	t.Cleanup(srv.Close)
+
+	cfg := &config.Config{
+		BulkCacheDir:         t.TempDir(),
+		DownloadMaxRetries:   2,
+		DownloadRetryBackoff: time.Millisecond,
+	}
+
+	data := &objects.BulkMetadata{
+		Type:        "default_cards",
+		UpdatedAt:   time.Date(2024, 1, 5, 10, 0, 0, 0, time.UTC),
+		Size:        size,
+		DownloadURI: srv.URL + "/default-cards.json",
+	}
+
+	return &metadataService{cfg: cfg, client: srv.Client()}, data
+}
+
+func partPath(m *metadataService, data *objects.BulkMetadata) string {
+	return fmt.Sprintf("%s.%d.part", m.bulkFilePath(data), data.UpdatedAt.Unix())
+}
+
+func assertNoParts(t *testing.T, m *metadataService, data *objects.BulkMetadata) {
+	t.Helper()
+
+	parts, _ := filepath.Glob(m.bulkFilePath(data) + ".*.part")
+
+	if len(parts) != 0 {
+		t.Errorf("part files left behind: %v", parts)
+	}
+}
+
+func TestDownloadBulkFileResumesFromPartOffset(t *testing.T) {
+	server := &bulkServer{body: bulkBody, cutAt: len(bulkBody) / 3}
+
+	m, data := newDownloadTest(t, server, len(bulkBody))
+
+	if err := m.DownloadBulkFile(context.Background(), data); err != nil {
+		t.Fatalf("DownloadBulkFile() error = %v", err)
+	}
+
+	want := []string{"", fmt.Sprintf("bytes=%d-", server.cutAt)}
+
+	if got := server.requestedRanges(); !slices.Equal(got, want) {
+		t.Errorf("requested ranges = %q, want %q", got, want)
+	}
+
+	got, err := os.ReadFile(m.bulkFilePath(data))
+
+	if err != nil {
+		t.Fatalf("could not read bulk file: %v", err)
+	}
+
+	if !bytes.Equal(got, bulkBody) {
+		t.Errorf("bulk file has %d bytes that differ from the %d served", len(got), len(bulkBody))
+	}
+
+	assertNoParts(t, m, data)
+}
+
+func TestDownloadBulkFileTruncatesPartWhenRangeIsIgnored(t *testing.T) {
+	server := &bulkServer{body: bulkBody, ignoreRange: true}
+
+	m, data := newDownloadTest(t, server, len(bulkBody))
+
+	if err := os.WriteFile(partPath(m, data), []byte(`[{"object":"stale"},`), 0600); err != nil {
+		t.Fatalf("could not write part file: %v", err)
+	}
+
+	if err := m.DownloadBulkFile(context.Background(), data); err != nil {
+		t.Fatalf("DownloadBulkFile() error = %v", err)
+	}
+
+	if got := server.requestedRanges(); len(got) != 1 || got[0] == "" {
+		t.Errorf("requested ranges = %q, want a single ranged request", got)
+	}
+
+	got, err := os.ReadFile(m.bulkFilePath(data))
+
+	if err != nil {
+		t.Fatalf("could not read bulk file: %v", err)
+	}
+
+	if !bytes.Equal(got, bulkBody) {
+		t.Errorf("bulk file has %d bytes, want the %d served with the part file truncated", len(got), len(bulkBody))
+	}
+
+	assertNoParts(t, m, data)
+}
+
+func TestDownloadBulkFileRejectsShortFile(t *testing.T) {
+	server := &bulkServer{body: bulkBody}
+
+	m, data := newDownloadTest(t, server, len(bulkBody)+1)
+
+	err := m.DownloadBulkFile(context.Background(), data)
+
+	if !errors.Is(err, ErrBulkSizeMismatch) {
+		t.Fatalf("DownloadBulkFile() error = %v, want %v", err, ErrBulkSizeMismatch)
+	}
+
+	if _, err := os.Stat(m.bulkFilePath(data)); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("bulk file was renamed into place, stat error = %v", err)
+	}
+
+	assertNoParts(t, m, data)
+}
+
+func TestOpenBulkFilePromotesStreamedCacheOfExpectedSize(t *testing.T) {
+	tests := []struct {
+		name    string
+		size    int
+		wantErr error
+	}{
+		{"expected size", len(bulkBody), nil},
+		{"unknown size", 0, nil},
+		{"short body", len(bulkBody) + 1, ErrBulkSizeMismatch},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, data := newDownloadTest(t, &bulkServer{body: bulkBody}, tt.size)
+
+			m.cfg.BulkStream = true
+			m.cfg.BulkStreamCache = true
+
+			got := readStream(t, m, data, tt.wantErr)
+
+			if !bytes.Equal(got, bulkBody) {
+				t.Errorf("stream returned %d bytes, want the %d served", len(got), len(bulkBody))
+			}
+
+			_, err := os.Stat(m.bulkFilePath(data))
+
+			if promoted := err == nil; promoted != (tt.wantErr == nil) {
+				t.Errorf("cache promoted = %v, want %v", promoted, tt.wantErr == nil)
+			}
+
+			if _, err := os.Stat(m.bulkFilePath(data) + ".part"); !errors.Is(err, os.ErrNotExist) {
+				t.Errorf("streamed part file left behind, stat error = %v", err)
+			}
+		})
+	}
+}
+
+func TestOpenBulkFileDecompressesGzipBody(t *testing.T) {
+	var compressed bytes.Buffer
+
+	gz := gzip.NewWriter(&compressed)
+	gz.Write(bulkBody)
+	gz.Close()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Write(compressed.Bytes())
+	}))
+
+	t.Cleanup(srv.Close)
+
+	m := &metadataService{
+		cfg:    &config.Config{BulkCacheDir: t.TempDir(), BulkStream: true, BulkStreamCache: true},
+		client: srv.Client(),
+	}
+
+	// The metadata size is the one of the uncompressed file.
+	data := &objects.BulkMetadata{Type: "default_cards", Size: len(bulkBody), DownloadURI: srv.URL}
+
+	if got := readStream(t, m, data, nil); !bytes.Equal(got, bulkBody) {
+		t.Errorf("stream returned %d bytes, want the %d uncompressed", len(got), len(bulkBody))
+	}
+
+	cached, err := os.ReadFile(m.bulkFilePath(data))
+
+	if err != nil {
+		t.Fatalf("could not read cached bulk file: %v", err)
+	}
+
+	if !bytes.Equal(cached, bulkBody) {
+		t.Errorf("cached bulk file has %d bytes, want the %d uncompressed", len(cached), len(bulkBody))
+	}
+}
+
+// readStream reads the whole bulk stream and checks that closing it returns
+// wantErr.
+func readStream(t *testing.T, m *metadataService, data *objects.BulkMetadata, wantErr error) []byte {
+	t.Helper()
+
+	stream, err := m.OpenBulkFile(context.Background(), data)
+
+	if err != nil {
+		t.Fatalf("OpenBulkFile() error = %v", err)
+	}
+
+	got, err := io.ReadAll(stream)
+
+	if err != nil {
+		t.Fatalf("could not read stream: %v", err)
+	}
+
+	if err := stream.Close(); !errors.Is(err, wantErr) {
+		t.Errorf("Close() error = %v, want %v", err, wantErr)
+	}
+
+	return got
+}
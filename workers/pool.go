@@ -0,0 +1,129 @@
+package workers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// maxCollectedErrors bounds how many task errors Wait reports when failures are
+// collected, so that a database outage does not produce one error per card.
+const maxCollectedErrors = 10
+
+// Pool runs tasks on a fixed number of goroutines, fed by a queue as long as the
+// number of workers.
+type Pool[T any] interface {
+	// Submit queues task, blocking while the queue is full. Once the pool stopped
+	// it returns the cause instead of queueing the task.
+	Submit(task T) error
+	// Wait stops taking tasks, waits for the queued ones and returns the errors of
+	// the tasks that failed.
+	Wait() error
+}
+
+type pool[T any] struct {
+	ctx      context.Context
+	cancel   context.CancelCauseFunc
+	tasks    chan T
+	wg       sync.WaitGroup
+	failFast bool
+	mu       sync.Mutex
+	errs     []error
+	failed   int
+}
+
+// NewPool starts size workers that call work for every submitted task. With
+// failFast the first error cancels the context passed to work and the tasks still
+// queued are dropped, like an errgroup; otherwise every task runs and the errors
+// are collected. Cancelling ctx drops the queued tasks either way.
+func NewPool[T any](ctx context.Context, size int, failFast bool, work func(ctx context.Context, task T) error) Pool[T] {
+	size = max(size, 1)
+
+	ctx, cancel := context.WithCancelCause(ctx)
+
+	p := &pool[T]{
+		ctx:      ctx,
+		cancel:   cancel,
+		tasks:    make(chan T, size),
+		failFast: failFast,
+	}
+
+	p.wg.Add(size)
+
+	for i := 0; i < size; i++ {
+		go p.run(work)
+	}
+
+	return p
+}
+
+func (p *pool[T]) run(work func(ctx context.Context, task T) error) {
+	defer p.wg.Done()
+
+	for task := range p.tasks {
+		if p.ctx.Err() != nil {
+			continue
+		}
+
+		if err := work(p.ctx, task); err != nil {
+			p.fail(err)
+		}
+	}
+}
+
+func (p *pool[T]) fail(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.failed++
+
+	if len(p.errs) < maxCollectedErrors {
+		p.errs = append(p.errs, err)
+	}
+
+	if p.failFast {
+		p.cancel(err)
+	}
+}
+
+func (p *pool[T]) Submit(task T) error {
+	// Checked first, as select picks randomly when the queue has room.
+	if p.ctx.Err() != nil {
+		return context.Cause(p.ctx)
+	}
+
+	select {
+	case p.tasks <- task:
+		return nil
+	case <-p.ctx.Done():
+		return context.Cause(p.ctx)
+	}
+}
+
+func (p *pool[T]) Wait() error {
+	close(p.tasks)
+
+	p.wg.Wait()
+
+	p.cancel(nil)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.failed == 0 {
+		return nil
+	}
+
+	if p.failFast {
+		return p.errs[0]
+	}
+
+	err := errors.Join(p.errs...)
+
+	if p.failed > len(p.errs) {
+		err = fmt.Errorf("%w\n(and %d more)", err, p.failed-len(p.errs))
+	}
+
+	return err
+}
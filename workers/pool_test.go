@@ -0,0 +1,98 @@
+package workers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestPoolFailFastDropsQueuedTasks(t *testing.T) {
+	errFirst := errors.New("first task failed")
+
+	release := make(chan struct{})
+
+	var mu sync.Mutex
+
+	var ran []int
+
+	pool := NewPool(context.Background(), 1, true, func(_ context.Context, task int) error {
+		mu.Lock()
+		ran = append(ran, task)
+		mu.Unlock()
+
+		if task == 0 {
+			<-release
+			return errFirst
+		}
+
+		return fmt.Errorf("task %d failed", task)
+	})
+
+	// Task 1 waits in the queue while the only worker is blocked on task 0.
+	for task := 0; task < 2; task++ {
+		if err := pool.Submit(task); err != nil {
+			t.Fatalf("Submit(%d) error = %v", task, err)
+		}
+	}
+
+	close(release)
+
+	if err := pool.Wait(); err != errFirst {
+		t.Errorf("Wait() error = %v, want %v", err, errFirst)
+	}
+
+	if !slices.Equal(ran, []int{0}) {
+		t.Errorf("ran tasks %v, want only task 0", ran)
+	}
+}
+
+func TestPoolCollectRunsEveryTask(t *testing.T) {
+	const tasks = 40
+
+	var ran atomic.Int64
+
+	pool := NewPool(context.Background(), 4, false, func(_ context.Context, task int) error {
+		ran.Add(1)
+
+		if task%2 == 1 {
+			return fmt.Errorf("task %d failed", task)
+		}
+
+		return nil
+	})
+
+	for task := 0; task < tasks; task++ {
+		if err := pool.Submit(task); err != nil {
+			t.Fatalf("Submit(%d) error = %v", task, err)
+		}
+	}
+
+	err := pool.Wait()
+
+	if got := ran.Load(); got != tasks {
+		t.Errorf("ran %d tasks, want %d", got, tasks)
+	}
+
+	if err == nil {
+		t.Fatal("Wait() error = nil, want the joined task errors")
+	}
+
+	joined, ok := errors.Unwrap(err).(interface{ Unwrap() []error })
+
+	if !ok {
+		t.Fatalf("Wait() error = %v, want joined errors with a count of the rest", err)
+	}
+
+	if got := len(joined.Unwrap()); got != maxCollectedErrors {
+		t.Errorf("Wait() joined %d errors, want %d", got, maxCollectedErrors)
+	}
+
+	if want := fmt.Sprintf("(and %d more)", tasks/2-maxCollectedErrors); !strings.HasSuffix(err.Error(), want) {
+		t.Errorf("Wait() error = %q, want it to end with %q", err, want)
+	}
+}